@@ -0,0 +1,40 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+
+	"github.com/lithammer/dedent"
+	edns "github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/ednsctl"
+	"github.com/spf13/cobra"
+)
+
+var danglingCmd = &cobra.Command{
+	Use:   "dangling",
+	Short: "Find owned records that point to targets the cluster no longer uses",
+	Long: dedent.Dedent(`
+		dangling reports the records owned by --owner whose targets are not the
+		load balancer or Gateway of any resource in the cluster. Such records may let
+		someone else take over the subdomain, so they are ranked by how easily the
+		target can be claimed: hosted service names first, then released public IPs,
+		then other hostnames, then cloud load balancer hostnames, then private addresses
+   `),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return edns.Dangling(context.Background(), newConfig(dnsProvider))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(danglingCmd)
+}
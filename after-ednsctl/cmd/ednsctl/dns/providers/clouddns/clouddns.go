@@ -8,3 +8,28 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+
+package clouddns
+
+import (
+	"github.com/spf13/pflag"
+)
+
+var (
+	project     string
+	managedZone string
+)
+
+// AddFlags registers the clouddns specific flags on the given flag set
+func AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&project, "project", "", "GCP project name (clouddns provider only)")
+	flags.StringVarP(&managedZone, "managed-zone", "m", "", "Managed zone name (clouddns provider only)")
+}
+
+// Config returns the provider specific configuration gathered from the clouddns flags
+func Config() map[string]string {
+	return map[string]string{
+		"project":      project,
+		"managed-zone": managedZone,
+	}
+}
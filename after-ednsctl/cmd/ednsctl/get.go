@@ -10,3 +10,49 @@
 // limitations under the License.
 
 package ednsctl
+
+import (
+	"context"
+
+	"github.com/lithammer/dedent"
+	edns "github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/ednsctl"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getFilter edns.Filter
+	getCmd    = &cobra.Command{
+		Use:   "get",
+		Short: "Display records or TXT registry entries from the dns-provider",
+		Long: dedent.Dedent(`
+			get prints the records or TXT registry entries found in the dns-provider
+			along with the external-dns owner and resource each one belongs to
+	   `),
+	}
+	getRecordsCmd = &cobra.Command{
+		Use:          "records",
+		Short:        "Display the records in the zone and the registry entry that owns them",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.GetRecords(context.Background(), newConfig(dnsProvider), &getFilter)
+		},
+	}
+	getRegistryCmd = &cobra.Command{
+		Use:          "registry",
+		Short:        "Display the TXT registry entries in the zone",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.GetRegistry(context.Background(), newConfig(dnsProvider), &getFilter)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.AddCommand(getRecordsCmd)
+	getCmd.AddCommand(getRegistryCmd)
+	getCmd.PersistentFlags().StringVar(&getFilter.Owner, "owned-by", "", "Only show entries owned by this external-dns owner")
+	getCmd.PersistentFlags().StringVar(&getFilter.Kind, "kind", "", "Only show entries for this resource kind e.g. ingress or service")
+	getCmd.PersistentFlags().StringVarP(&getFilter.Namespace, "namespace", "n", "", "Only show entries for resources in this namespace")
+	getCmd.PersistentFlags().StringVar(&getFilter.Name, "name", "", "Only show entries whose hostname matches this glob e.g. *.example.com")
+}
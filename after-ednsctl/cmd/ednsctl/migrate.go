@@ -10,3 +10,87 @@
 // limitations under the License.
 
 package ednsctl
+
+import (
+	"context"
+
+	"github.com/lithammer/dedent"
+	edns "github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/ednsctl"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateDeleteOld bool
+	migrateYes       bool
+	migrateFrom      string
+	migrateTo        string
+	migrateCmd       = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the TXT registry to new settings",
+		Long: dedent.Dedent(`
+			migrate plans a change to the TXT registry in the dns-provider, prints the
+			plan and applies it once confirmed
+	   `),
+	}
+	migrateOwnerCmd = &cobra.Command{
+		Use:   "owner",
+		Short: "Move every TXT registry record from one owner to another",
+		Long: dedent.Dedent(`
+			owner rewrites every TXT registry record owned by --from so that it is owned
+			by --to, e.g. after renaming the cluster external-dns runs in
+	   `),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.MigrateOwner(context.Background(), newConfig(dnsProvider), migrateFrom, migrateTo, migrateYes)
+		},
+	}
+	migratePrefixCmd = &cobra.Command{
+		Use:   "prefix",
+		Short: "Move the TXT registry of --owner from one prefix to another",
+		Long: dedent.Dedent(`
+			prefix creates a TXT registry record with the --to prefix for every record
+			owned by --owner with the --from prefix and checks that every record is still
+			owned afterwards. The old TXT registry records are deleted with --delete-old
+	   `),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.MigratePrefix(context.Background(), newConfig(dnsProvider), migrateFrom, migrateTo, migrateDeleteOld, migrateYes)
+		},
+	}
+	migrateZoneCmd = &cobra.Command{
+		Use:   "zone",
+		Short: "Copy the records of --owner and their TXT registry to another provider",
+		Long: dedent.Dedent(`
+			zone copies every record owned by --owner along with its TXT registry record
+			from the --from provider to the --to provider. Records that can not be
+			represented on the target provider, such as route53 alias targets, are reported
+			and skipped
+	   `),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.MigrateZone(context.Background(), newConfig(migrateFrom), newConfig(migrateTo), migrateYes)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateOwnerCmd)
+	migrateCmd.PersistentFlags().BoolVarP(&migrateYes, "yes", "y", false, "Apply the plan without asking for confirmation")
+	migrateOwnerCmd.Flags().StringVar(&migrateFrom, "from", "", "Current owner of the TXT registry records (required)")
+	migrateOwnerCmd.Flags().StringVar(&migrateTo, "to", "", "New owner of the TXT registry records (required)")
+	migrateOwnerCmd.MarkFlagRequired("from")
+	migrateOwnerCmd.MarkFlagRequired("to")
+
+	migrateCmd.AddCommand(migratePrefixCmd)
+	migratePrefixCmd.Flags().StringVar(&migrateFrom, "from", "", "Current TXT registry prefix; default is none")
+	migratePrefixCmd.Flags().StringVar(&migrateTo, "to", "", "New TXT registry prefix (required)")
+	migratePrefixCmd.Flags().BoolVar(&migrateDeleteOld, "delete-old", false, "Delete the TXT registry records with the old prefix once the migration is verified")
+	migratePrefixCmd.MarkFlagRequired("to")
+
+	migrateCmd.AddCommand(migrateZoneCmd)
+	migrateZoneCmd.Flags().StringVar(&migrateFrom, "from", "", "Provider to copy the records from (required)")
+	migrateZoneCmd.Flags().StringVar(&migrateTo, "to", "", "Provider to copy the records to (required)")
+	migrateZoneCmd.MarkFlagRequired("from")
+	migrateZoneCmd.MarkFlagRequired("to")
+}
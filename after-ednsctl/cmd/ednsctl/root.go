@@ -13,17 +13,24 @@ package ednsctl
 
 import (
 	"github.com/lithammer/dedent"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/cmd/ednsctl/dns/providers/clouddns"
+	edns "github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/ednsctl"
 	"github.com/spf13/cobra"
 )
 
 var (
-	// apiKey      string
-	// apiUser     string
-	dnsProvider string
-	dnsZone     string
-	txtPrefix   string
-	txtOwner    string
-	rootCmd     = &cobra.Command{
+	batchSize         int
+	dnsProvider       string
+	dnsZone           string
+	ignoredSubdomains []string
+	ingressClasses    []string
+	aesKey            []byte
+	aesKeyFile        string
+	txtPrefix         string
+	txtOwner          string
+	txtSuffix         string
+	txtWildcard       string
+	rootCmd           = &cobra.Command{
 		Use:   "ednsctl",
 		Short: "Verify external-dns TXT registry and created records are in sync",
 		Long: dedent.Dedent(`
@@ -31,6 +38,11 @@ var (
 				them with the given dns-provider to validate external-dns A records as well
 				as the TXT registry
 	   `),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			aesKey, err = edns.LoadAESKey(aesKeyFile)
+			return err
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 		},
 	}
@@ -42,18 +54,45 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
+// newConfig builds the application config for the given provider from the persistent flags
+func newConfig(provider string) *edns.Config {
+	conf := edns.Config{
+		BatchSize:         batchSize,
+		IgnoredSubdomains: ignoredSubdomains,
+		IngressClasses:    ingressClasses,
+		Provider:          provider,
+		RegistryAESKey:    aesKey,
+		RegistryOwner:     txtOwner,
+		RegistryPrefix:    txtPrefix,
+		RegistrySuffix:    txtSuffix,
+		RegistryWildcard:  txtWildcard,
+		Zone:              dnsZone,
+	}
+	switch provider {
+	case "clouddns":
+		{
+			conf.ProviderSpecificConfig = clouddns.Config()
+		}
+	}
+	return &conf
+}
+
 func init() {
 	// Required Flags
 	rootCmd.PersistentFlags().StringVarP(&dnsZone, "dns-zone", "z", "", "DNS Zone name e.g. example.com (required)")
-	rootCmd.PersistentFlags().StringVarP(&dnsProvider, "provider", "p", "", "DNS Provider (required)")
+	rootCmd.PersistentFlags().StringVarP(&dnsProvider, "provider", "p", "", "DNS Provider: route53, cloudflare or clouddns (required except for migrate zone)")
 	rootCmd.MarkPersistentFlagRequired("dns-zone")
-	rootCmd.MarkPersistentFlagRequired("provider")
 
 	// Optional Flags
-	// TODO: Remove the api key flags and require environment variables in each DNS provider where necessary
-	// rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "API key for the DNS provider, overwrites EDNS_API_KEY env var")
-	// rootCmd.PersistentFlags().StringVarP(&apiUser, "api-user", "u", "", "API user for the DNS provider, overwrites EDNS_API_USER env var")
 	rootCmd.PersistentFlags().StringVar(&txtPrefix, "prefix", "", "TXT registry prefix setting in external-dns; default is none")
+	rootCmd.PersistentFlags().StringVar(&txtSuffix, "suffix", "", "TXT registry suffix setting in external-dns, added to the first label of the name; default is none")
+	rootCmd.PersistentFlags().StringVar(&txtWildcard, "wildcard-replacement", "", "TXT registry wildcard replacement setting in external-dns; default is none")
 	rootCmd.PersistentFlags().StringVar(&txtOwner, "owner", "default", "TXT registry owner setting in external-dns")
-	rootCmd.PersistentFlags().StringVarP(&txtOwner, "managed-zone", "m", "", "Managed zone name (clouddns provider only)")
+	rootCmd.PersistentFlags().StringVar(&aesKeyFile, "aes-key-file", "", "File holding the key external-dns encrypts TXT registry records with, new TXT registry records are encrypted with it too; defaults to the EDNS_TXT_AES_KEY environment variable")
+	rootCmd.PersistentFlags().IntVar(&batchSize, "batch-size", 0, "Maximum number of changes applied together; defaults to 100")
+	rootCmd.PersistentFlags().StringSliceVarP(&ignoredSubdomains, "ignored-subdomains", "i", make([]string, 0), "subdomains to ignore if necessary (comma separated list)")
+	rootCmd.PersistentFlags().StringSliceVar(&ingressClasses, "ingress-class", make([]string, 0), "Only look at ingresses of these classes, matching the --ingress-class setting in external-dns; default is every ingress")
+
+	// Provider Specific Flags
+	clouddns.AddFlags(rootCmd.PersistentFlags())
 }
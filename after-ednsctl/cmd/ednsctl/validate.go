@@ -10,3 +10,39 @@
 // limitations under the License.
 
 package ednsctl
+
+import (
+	"context"
+
+	"github.com/lithammer/dedent"
+	edns "github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/ednsctl"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateFix bool
+	validateYes bool
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the TXT registry against the cluster",
+		Long: dedent.Dedent(`
+			validate compares the records and TXT registry in the dns-provider with the
+			ingresses, services, Gateway API routes, Istio resources and DNSEndpoints in
+			the cluster and reports records that can be deleted, records owned by another
+			registry, records missing TXT registry entries and records that differ from
+			their DNSEndpoint. With --fix the missing TXT registry entries are added. The
+			deletable records have no TXT registry entry so nothing proves they are owned,
+			they are only reported and have to be deleted by hand
+	   `),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return edns.Validate(context.Background(), newConfig(dnsProvider), validateFix, validateYes)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().BoolVar(&validateFix, "fix", false, "Add the missing TXT registry records")
+	validateCmd.Flags().BoolVarP(&validateYes, "yes", "y", false, "Apply the fix without asking for confirmation")
+}
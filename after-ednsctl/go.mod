@@ -1,8 +1,15 @@
 module github.com/lucasreed/go-interface-refactoring/after-ednsctl
 
-go 1.12
+go 1.13
 
 require (
+	github.com/aws/aws-sdk-go v1.25.9
+	github.com/cloudflare/cloudflare-go v0.10.3
 	github.com/lithammer/dedent v1.1.0
 	github.com/spf13/cobra v0.0.5
+	github.com/spf13/pflag v1.0.5
+	google.golang.org/api v0.20.0
+	k8s.io/api v0.20.0
+	k8s.io/apimachinery v0.20.0
+	k8s.io/client-go v0.20.0
 )
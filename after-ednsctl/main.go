@@ -12,9 +12,13 @@
 package main
 
 import (
+	"os"
+
 	cmd "github.com/lucasreed/go-interface-refactoring/after-ednsctl/cmd/ednsctl"
 )
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,213 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+// Risk ranks how easily a dangling record can be taken over
+type Risk int
+
+const (
+	// LowRisk targets are private or reserved addresses nobody outside the network can claim
+	LowRisk Risk = iota
+	// MediumRisk targets are hostnames that can not be registered again by name,
+	// such as cloud load balancers whose names end with a generated id
+	MediumRisk
+	// UnknownRisk targets are hostnames of other services, whether they can be claimed is not known
+	UnknownRisk
+	// HighRisk targets are public IPs that the cloud provider hands out to other customers once released
+	HighRisk
+	// CriticalRisk targets are hostnames of hosted services that anyone can claim by name
+	CriticalRisk
+)
+
+func (r Risk) String() string {
+	switch r {
+	case CriticalRisk:
+		{
+			return "critical"
+		}
+	case HighRisk:
+		{
+			return "high"
+		}
+	case UnknownRisk:
+		{
+			return "unknown"
+		}
+	case MediumRisk:
+		{
+			return "medium"
+		}
+	default:
+		{
+			return "low"
+		}
+	}
+}
+
+// claimableSuffixes are the domains of hosted services that let anyone pick the
+// hostname of their site, bucket or app
+var claimableSuffixes = []string{
+	".azurewebsites.net",
+	".blob.core.windows.net",
+	".cloudapp.azure.com",
+	".cloudapp.net",
+	".cloudfront.net",
+	".github.io",
+	".herokuapp.com",
+	".s3.amazonaws.com",
+	".trafficmanager.net",
+}
+
+// loadBalancerPattern matches the hostnames of AWS load balancers, both
+// name-id.<region>.elb.amazonaws.com and the name-id.elb.<region>.amazonaws.com
+// of network load balancers
+var loadBalancerPattern = regexp.MustCompile(`\.elb(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+// reservedNetworks are the address ranges that are not routed on the internet
+var reservedNetworks = parseNetworks("10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+// DanglingRecord is an owned record with a target that no resource in the cluster uses
+type DanglingRecord struct {
+	Record dns.Record
+	Target string
+	Risk   Risk
+	Reason string
+}
+
+// Dangling prints the records owned by the configured registry owner whose
+// targets are not used by any load balancer in the cluster, most easily taken
+// over first
+func Dangling(ctx context.Context, conf *Config) error {
+	err := conf.configure(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conf.Kube.GetHosts(ctx)
+	if err != nil {
+		return err
+	}
+	records, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+	dangling := conf.findDangling(records, registry, conf.Kube.ValidTargets)
+
+	fmt.Printf("The following owned records point to targets no resource in the cluster uses (%d items)\n", len(dangling))
+	if len(dangling) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RISK\tNAME\tTYPE\tTARGET\tREASON")
+	for _, item := range dangling {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.Risk, item.Record.Name, item.Record.DisplayType(), item.Target, item.Reason)
+	}
+	return w.Flush()
+}
+
+// findDangling returns the dangling targets of the owned records sorted by
+// descending risk and then by name
+func (conf *Config) findDangling(records []dns.Record, registry map[string]dns.RegistryRecord, validTargets map[string][]string) []DanglingRecord {
+	var ret []DanglingRecord
+	for _, record := range records {
+		reg, exists := conf.registryNames().Lookup(registry, record.Name, record.Type)
+		if !exists || reg.Owner != conf.RegistryOwner {
+			continue
+		}
+		for _, target := range record.Targets {
+			if isValidTarget(target, validTargets) {
+				continue
+			}
+			risk, reason := takeoverRisk(target)
+			ret = append(ret, DanglingRecord{
+				Record: record,
+				Target: target,
+				Risk:   risk,
+				Reason: reason,
+			})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Risk != ret[j].Risk {
+			return ret[i].Risk > ret[j].Risk
+		}
+		return ret[i].Record.Name < ret[j].Record.Name
+	})
+	return ret
+}
+
+// takeoverRisk ranks the target of a dangling record and explains the ranking
+func takeoverRisk(target string) (Risk, string) {
+	if ip := net.ParseIP(target); ip != nil {
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || inNetworks(ip, reservedNetworks) {
+			return LowRisk, "private address"
+		}
+		return HighRisk, "released public IP may be assigned to another customer"
+	}
+	host := strings.ToLower(strings.TrimSuffix(target, "."))
+	switch {
+	case hasAnySuffix(host, claimableSuffixes) || strings.Contains(host, ".s3-website"):
+		{
+			return CriticalRisk, "hosted service name can be claimed by anyone"
+		}
+	case loadBalancerPattern.MatchString(host):
+		{
+			return MediumRisk, "load balancer name ends with a generated id and can not be claimed again"
+		}
+	default:
+		{
+			return UnknownRisk, "hostname is not used by the cluster"
+		}
+	}
+}
+
+func hasAnySuffix(host string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var ret []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, network)
+	}
+	return ret
+}
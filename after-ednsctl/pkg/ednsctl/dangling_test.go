@@ -0,0 +1,91 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"testing"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+func TestTakeoverRisk(t *testing.T) {
+	tests := map[string]Risk{
+		"10.1.2.3":                  LowRisk,
+		"192.168.0.10":              LowRisk,
+		"127.0.0.1":                 LowRisk,
+		"fd00::1":                   LowRisk,
+		"52.1.2.3":                  HighRisk,
+		"2600:1f18::1":              HighRisk,
+		"my-site.azurewebsites.net": CriticalRisk,
+		"bucket.s3.amazonaws.com.":  CriticalRisk,
+		"bucket.s3-website-us-east-1.amazonaws.com": CriticalRisk,
+		"user.github.io": CriticalRisk,
+		"web-1234567890.us-east-1.elb.amazonaws.com":            MediumRisk,
+		"dualstack.web-1234567890.us-east-1.elb.amazonaws.com.": MediumRisk,
+		"internal-web-1234.eu-west-1.elb.amazonaws.com":         MediumRisk,
+		"nlb-0123456789abcdef.elb.us-east-1.amazonaws.com":      MediumRisk,
+		"nlb-0123456789abcdef.elb.cn-north-1.amazonaws.com.cn":  MediumRisk,
+		"web-1234567890.cn-north-1.elb.amazonaws.com.cn":        MediumRisk,
+		"lb.example.net":                UnknownRisk,
+		"elb.amazonaws.com.example.net": UnknownRisk,
+		"web.elbamazonaws.com":          UnknownRisk,
+	}
+	for target, want := range tests {
+		if got, _ := takeoverRisk(target); got != want {
+			t.Errorf("takeoverRisk(%s) = %s, want %s", target, got, want)
+		}
+	}
+}
+
+func TestFindDanglingOrder(t *testing.T) {
+	conf := &Config{RegistryOwner: "default"}
+	registry := make(map[string]dns.RegistryRecord)
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com", "f.example.com"} {
+		registry[name] = dns.RegistryRecord{Name: name, Owner: "default"}
+	}
+	registry["other.example.com"] = dns.RegistryRecord{Name: "other.example.com", Owner: "someone-else"}
+	records := []dns.Record{
+		{Name: "a.example.com", Type: "A", Targets: []string{"10.0.0.1"}},
+		{Name: "b.example.com", Type: "CNAME", Targets: []string{"nlb-1234.elb.us-east-1.amazonaws.com"}},
+		{Name: "c.example.com", Type: "CNAME", Targets: []string{"lb.example.net"}},
+		{Name: "d.example.com", Type: "A", Targets: []string{"52.1.2.3", "52.1.2.4"}},
+		{Name: "e.example.com", Type: "CNAME", Targets: []string{"site.herokuapp.com"}},
+		{Name: "f.example.com", Type: "CNAME", Targets: []string{"live.elb.amazonaws.com"}},
+		{Name: "other.example.com", Type: "CNAME", Targets: []string{"site.github.io"}},
+		{Name: "unowned.example.com", Type: "CNAME", Targets: []string{"site.github.io"}},
+	}
+	validTargets := map[string][]string{
+		"live.elb.amazonaws.com": {"service/web"},
+		"52.1.2.4":               {"service/api"},
+	}
+
+	got := conf.findDangling(records, registry, validTargets)
+	want := []struct {
+		name   string
+		target string
+		risk   Risk
+	}{
+		{"e.example.com", "site.herokuapp.com", CriticalRisk},
+		{"d.example.com", "52.1.2.3", HighRisk},
+		{"c.example.com", "lb.example.net", UnknownRisk},
+		{"b.example.com", "nlb-1234.elb.us-east-1.amazonaws.com", MediumRisk},
+		{"a.example.com", "10.0.0.1", LowRisk},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findDangling returned %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i, item := range want {
+		if got[i].Record.Name != item.name || got[i].Target != item.target || got[i].Risk != item.risk {
+			t.Errorf("dangling record %d is %s %s (%s), want %s %s (%s)", i, got[i].Record.Name, got[i].Target, got[i].Risk, item.name, item.target, item.risk)
+		}
+	}
+}
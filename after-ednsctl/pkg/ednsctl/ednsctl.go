@@ -0,0 +1,155 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns/clouddns"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns/cloudflare"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns/route53"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/kubernetes"
+)
+
+// Config represents everything we need to know about a DNS Provider
+type Config struct {
+	API                    dns.API
+	BatchSize              int
+	IgnoredSubdomains      []string
+	IngressClasses         []string // IngressClasses limits the ingresses looked at to those handled by external-dns
+	Kube                   *kubernetes.Kube
+	Provider               string
+	ProviderSpecificConfig map[string]string
+	RegistryAESKey         []byte // RegistryAESKey is the external-dns TXT registry encryption key, providers get it as RegistryKey
+	RegistryPrefix         string
+	RegistryOwner          string
+	RegistrySuffix         string
+	RegistryWildcard       string // RegistryWildcard replaces a leading * in the names of TXT registry records
+	Zone                   string
+}
+
+// AESKeyEnv is the environment variable holding the TXT registry encryption key
+const AESKeyEnv = "EDNS_TXT_AES_KEY"
+
+// LoadAESKey returns the TXT registry encryption key read from the given file,
+// or from the EDNS_TXT_AES_KEY environment variable if no file is given. It
+// returns nil when neither is set.
+func LoadAESKey(file string) ([]byte, error) {
+	key := os.Getenv(AESKeyEnv)
+	if file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read the TXT registry encryption key: %v", err)
+		}
+		key = string(content)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return dns.ParseAESKey(key)
+}
+
+// registryNames returns the NameMapper of the configured registry prefix, suffix
+// and wildcard replacement
+func (conf *Config) registryNames() dns.NameMapper {
+	return dns.NameMapper{
+		Prefix:              conf.RegistryPrefix,
+		Suffix:              conf.RegistrySuffix,
+		WildcardReplacement: conf.RegistryWildcard,
+	}
+}
+
+// unaffixedNames returns the NameMapper of registry records written without
+// the configured prefix and suffix
+func (conf *Config) unaffixedNames() dns.NameMapper {
+	return dns.NameMapper{
+		WildcardReplacement: conf.RegistryWildcard,
+	}
+}
+
+// readZone lists the records of the configured provider once and returns the
+// ones of the RecordTypes along with the TXT registry, so both describe the
+// zone at the same point in time
+func (conf *Config) readZone(ctx context.Context) ([]dns.Record, map[string]dns.RegistryRecord, error) {
+	records, err := conf.API.GetRecords(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dns.ParseRecords(records), dns.ParseRegistry(records, conf.RegistryAESKey), nil
+}
+
+func (conf *Config) configure(ctx context.Context) error {
+	err := conf.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	if conf.Kube != nil {
+		return nil
+	}
+	conf.Kube, err = kubernetes.New(ctx, conf.Zone, conf.IgnoredSubdomains)
+	if err != nil {
+		return err
+	}
+	conf.Kube.IngressClasses = conf.IngressClasses
+	return nil
+}
+
+// configureAPI sets up the API for the configured provider unless one was already given
+func (conf *Config) configureAPI(ctx context.Context) error {
+	if conf.API != nil {
+		return nil
+	}
+	switch conf.Provider {
+	case "clouddns":
+		{
+			api, err := clouddns.NewAPI(ctx, conf.ProviderSpecificConfig)
+			if err != nil {
+				return err
+			}
+			api.RegistryKey = conf.RegistryAESKey
+			conf.API = api
+			return nil
+		}
+	case "cloudflare":
+		{
+			api, err := cloudflare.NewAPI(ctx, conf.Zone)
+			if err != nil {
+				return err
+			}
+			api.RegistryKey = conf.RegistryAESKey
+			conf.API = api
+			return nil
+		}
+	case "route53":
+		{
+			api, err := route53.NewAPI(ctx, conf.Zone)
+			if err != nil {
+				return err
+			}
+			api.RegistryKey = conf.RegistryAESKey
+			conf.API = api
+			return nil
+		}
+	case "":
+		{
+			return fmt.Errorf("A DNS provider is required, set one with --provider")
+		}
+	default:
+		{
+			return fmt.Errorf("This DNS provider is not supported: %s", conf.Provider)
+		}
+	}
+}
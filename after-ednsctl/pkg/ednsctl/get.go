@@ -0,0 +1,117 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+// Filter narrows down the records and registry entries printed by the get command.
+// Empty fields match everything.
+type Filter struct {
+	Kind      string
+	Name      string // Name is a glob matched against the hostname e.g. *.example.com
+	Namespace string
+	Owner     string
+}
+
+// GetRecords prints the records in the zone along with the registry entry that owns them
+func GetRecords(ctx context.Context, conf *Config, filter *Filter) error {
+	err := conf.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	records, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tTARGET\tOWNER\tRESOURCE\tFORMAT")
+	for _, record := range records {
+		reg, exists := conf.registryNames().Lookup(registry, record.Name, record.Type)
+		if !exists {
+			reg, _ = conf.unaffixedNames().Lookup(registry, record.Name, record.Type)
+		}
+		if !filter.match(record.Name, reg) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", record.Name, record.DisplayType(), record.Target(), valueOrNone(reg.Owner), valueOrNone(reg.Resource), valueOrNone(string(reg.Format)))
+	}
+	return w.Flush()
+}
+
+// GetRegistry prints the TXT registry entries in the zone
+func GetRegistry(ctx context.Context, conf *Config, filter *Filter) error {
+	err := conf.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	_, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tHOSTNAME\tTYPE\tFORMAT\tOWNER\tRESOURCE\tHERITAGE")
+	for _, name := range names {
+		reg := registry[name]
+		hostname, recordType, format, ok := conf.registryNames().Resolve(name)
+		if !ok {
+			hostname, recordType, format, _ = conf.unaffixedNames().Resolve(name)
+		}
+		if !filter.match(hostname, reg) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, hostname, valueOrNone(recordType), format, reg.Owner, valueOrNone(reg.Resource), reg.Heritage)
+	}
+	return w.Flush()
+}
+
+func (f *Filter) match(hostname string, reg dns.RegistryRecord) bool {
+	if f.Name != "" {
+		if matched, _ := path.Match(f.Name, hostname); !matched {
+			return false
+		}
+	}
+	if f.Owner != "" && f.Owner != reg.Owner {
+		return false
+	}
+	kind, namespace, _ := reg.SplitResource()
+	if f.Kind != "" && !strings.EqualFold(f.Kind, kind) {
+		return false
+	}
+	if f.Namespace != "" && f.Namespace != namespace {
+		return false
+	}
+	return true
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
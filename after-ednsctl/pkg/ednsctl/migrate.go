@@ -0,0 +1,388 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+// RegistryChange is a single planned change to a TXT registry record.
+// An empty NewValue means the registry record is deleted.
+type RegistryChange struct {
+	Name     string
+	OldValue string
+	NewValue string
+}
+
+// MigrateOwner rewrites every TXT registry record owned by from so that it is owned by to.
+// The plan is printed and, unless assumeYes is set, has to be confirmed before it is applied.
+func MigrateOwner(ctx context.Context, conf *Config, from, to string, assumeYes bool) error {
+	if from == "" || to == "" {
+		return fmt.Errorf("Both the current and the new owner are required")
+	}
+	if from == to {
+		return fmt.Errorf("The current and the new owner are the same: %s", from)
+	}
+	err := conf.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	_, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+
+	var plan []RegistryChange
+	var malformed []dns.RegistryRecord
+	for name, reg := range registry {
+		if reg.Owner != from {
+			continue
+		}
+		if len(reg.Problems) > 0 {
+			malformed = append(malformed, reg)
+			continue
+		}
+		plan = append(plan, RegistryChange{
+			Name:     name,
+			OldValue: reg.Value(),
+			NewValue: reg.WithOwner(to).Value(),
+		})
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].Name < plan[j].Name
+	})
+	sort.Slice(malformed, func(i, j int) bool {
+		return malformed[i].Name < malformed[j].Name
+	})
+
+	fmt.Printf("The following TXT registry records will move from owner %s to owner %s (%d items)\n", from, to, len(plan))
+	printPlan(plan)
+	if len(malformed) > 0 {
+		fmt.Printf("\nThe following TXT registry records of owner %s are malformed and will be left alone (%d items)\n", from, len(malformed))
+		for _, reg := range malformed {
+			fmt.Printf("TXT Record: %s\n", reg.Name)
+			for _, problem := range reg.Problems {
+				fmt.Printf("Problem: %s\n", problem)
+			}
+		}
+	}
+	if len(plan) == 0 {
+		return nil
+	}
+	if !assumeYes && !confirm() {
+		fmt.Println("Aborted, no changes were made")
+		return nil
+	}
+	return conf.apply(ctx, registryChanges(plan))
+}
+
+// MigratePrefix copies every TXT registry record of the configured owner from
+// the from prefix to the to prefix. Once every record has been verified to be
+// owned under the new prefix the old registry records are deleted if deleteOld is set.
+func MigratePrefix(ctx context.Context, conf *Config, from, to string, deleteOld, assumeYes bool) error {
+	if from == to {
+		return fmt.Errorf("The current and the new prefix are the same: %q", from)
+	}
+	err := conf.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	records, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+
+	fromNames, toNames := conf.registryNames(), conf.registryNames()
+	fromNames.Prefix, toNames.Prefix = from, to
+	var owned []dns.Record
+	var creates, deletes []RegistryChange
+	var seen = make(map[string]bool)
+	for _, record := range records {
+		reg, exists := fromNames.Lookup(registry, record.Name, record.Type)
+		if !exists || reg.Owner != conf.RegistryOwner {
+			continue
+		}
+		owned = append(owned, record)
+		if seen[reg.Name] {
+			continue
+		}
+		seen[reg.Name] = true
+		value := reg.Value()
+		name := toNames.RegistryName(record.Name, reg.RecordType, reg.Format)
+		if _, exists := registry[name]; !exists {
+			creates = append(creates, RegistryChange{
+				Name:     name,
+				NewValue: value,
+			})
+		}
+		if deleteOld {
+			deletes = append(deletes, RegistryChange{
+				Name:     reg.Name,
+				OldValue: value,
+			})
+		}
+	}
+	sort.Slice(creates, func(i, j int) bool {
+		return creates[i].Name < creates[j].Name
+	})
+	sort.Slice(deletes, func(i, j int) bool {
+		return deletes[i].Name < deletes[j].Name
+	})
+
+	fmt.Printf("The following TXT registry records will be created with prefix %q (%d items)\n", to, len(creates))
+	printPlan(creates)
+	if deleteOld {
+		fmt.Printf("\nThe following TXT registry records with prefix %q will be deleted (%d items)\n", from, len(deletes))
+		printPlan(deletes)
+	}
+	if len(creates)+len(deletes) == 0 {
+		return nil
+	}
+	if !assumeYes && !confirm() {
+		fmt.Println("Aborted, no changes were made")
+		return nil
+	}
+	err = conf.apply(ctx, registryChanges(creates))
+	if err != nil {
+		return err
+	}
+
+	_, registry, err = conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+	var unowned []dns.Record
+	for _, record := range owned {
+		if reg, exists := toNames.Lookup(registry, record.Name, record.Type); !exists || reg.Owner != conf.RegistryOwner {
+			unowned = append(unowned, record)
+		}
+	}
+	if len(unowned) > 0 {
+		fmt.Printf("\nThe following records are not owned by %s with prefix %q (%d items)\n", conf.RegistryOwner, to, len(unowned))
+		for _, record := range unowned {
+			fmt.Printf("Record: %s %s\n", record.Name, record.DisplayType())
+		}
+		return fmt.Errorf("%d records are not owned with the new prefix, the old TXT registry records were kept", len(unowned))
+	}
+	fmt.Printf("All %d records are owned by %s with prefix %q\n", len(owned), conf.RegistryOwner, to)
+	if !deleteOld {
+		return nil
+	}
+	return conf.apply(ctx, registryChanges(deletes))
+}
+
+// MigrateZone copies the records owned by the configured owner along with their
+// TXT registry records from the source provider to the target provider. Records
+// that can not be represented on the target or would overwrite something else are
+// reported and skipped.
+func MigrateZone(ctx context.Context, source, target *Config, assumeYes bool) error {
+	if source.Provider == target.Provider {
+		return fmt.Errorf("The source and the target provider are the same: %s", source.Provider)
+	}
+	err := source.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	err = target.configureAPI(ctx)
+	if err != nil {
+		return err
+	}
+	sourceRecords, sourceRegistry, err := source.readZone(ctx)
+	if err != nil {
+		return err
+	}
+	targetRecords, targetRegistry, err := target.readZone(ctx)
+	if err != nil {
+		return err
+	}
+
+	var existingRecords = make(map[string][]dns.Record)
+	for _, record := range targetRecords {
+		existingRecords[record.Name] = append(existingRecords[record.Name], record)
+	}
+	var records []dns.Record
+	var registry = make(map[string]RegistryChange)
+	var skipped = make(map[string]string)
+	for _, record := range sourceRecords {
+		name := record.Name
+		key := name + " " + record.DisplayType()
+		reg, exists := source.registryNames().Lookup(sourceRegistry, name, record.Type)
+		if !exists || reg.Owner != source.RegistryOwner {
+			continue
+		}
+		if reason := unrepresentable(record, target.Provider); reason != "" {
+			skipped[key] = reason
+			continue
+		}
+		if existing := conflict(record, existingRecords[name]); existing != "" {
+			skipped[key] = fmt.Sprintf("%s already has %s", target.Provider, existing)
+			continue
+		}
+		if existing, exists := target.registryNames().Lookup(targetRegistry, name, record.Type); exists && existing.Owner != target.RegistryOwner {
+			skipped[key] = fmt.Sprintf("%s already has a TXT registry record owned by %s", target.Provider, existing.Owner)
+			continue
+		}
+		records = append(records, record)
+		registry[key] = RegistryChange{
+			Name:     target.registryNames().RegistryName(name, reg.RecordType, reg.Format),
+			NewValue: reg.WithOwner(target.RegistryOwner).Value(),
+		}
+	}
+
+	fmt.Printf("The following records will be copied from %s to %s (%d items)\n", source.Provider, target.Provider, len(records))
+	for _, record := range records {
+		fmt.Printf("Record: %s %s %s\n", record.Name, record.DisplayType(), record.Target())
+		change := registry[record.Name+" "+record.DisplayType()]
+		fmt.Printf("TXT Record: %s\n", change.Name)
+		fmt.Printf("TXT Record Value: %s\n", change.NewValue)
+	}
+	fmt.Printf("\nThe following records can not be copied to %s (%d items)\n", target.Provider, len(skipped))
+	var names []string
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Record: %s\n", name)
+		fmt.Printf("Reason: %s\n", skipped[name])
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if !assumeYes && !confirm() {
+		fmt.Println("Aborted, no changes were made")
+		return nil
+	}
+	var changes dns.ChangeSet
+	var registered = make(map[string]bool)
+	for _, record := range records {
+		changes = append(changes, dns.Change{Action: dns.SetRecordAction, Record: record})
+		change := registry[record.Name+" "+record.DisplayType()]
+		if !registered[change.Name] {
+			changes = append(changes, change.change())
+			registered[change.Name] = true
+		}
+	}
+	return target.apply(ctx, changes)
+}
+
+// conflict describes the record of the target provider that would be
+// overwritten by the record or returns an empty string if there is none
+func conflict(record dns.Record, existing []dns.Record) string {
+	for _, item := range existing {
+		switch {
+		case item.Type == record.Type && !sameTargets(item.Targets, record.Targets):
+			{
+				return fmt.Sprintf("a %s record pointing to %s", item.DisplayType(), item.Target())
+			}
+		case item.Type != record.Type && (item.Type == "CNAME" || record.Type == "CNAME"):
+			{
+				return fmt.Sprintf("a %s record with the same name", item.DisplayType())
+			}
+		}
+	}
+	return ""
+}
+
+// unrepresentable returns why the record can not be created on the target
+// provider or an empty string if it can
+func unrepresentable(record dns.Record, provider string) string {
+	if record.Alias() || record.Type == "ALIAS" {
+		return fmt.Sprintf("alias target %s only exists in the source provider", record.Target())
+	}
+	if setIdentifier := record.Metadata[dns.SetIdentifierMetadata]; setIdentifier != "" && provider != "route53" {
+		return fmt.Sprintf("set identifier %s of a weighted, latency or failover record set is only supported by route53", setIdentifier)
+	}
+	for _, target := range record.Targets {
+		ip := net.ParseIP(target)
+		switch record.Type {
+		case "A":
+			{
+				if ip == nil || ip.To4() == nil {
+					return fmt.Sprintf("target %s is not an IPv4 address", target)
+				}
+			}
+		case "AAAA":
+			{
+				if ip == nil || ip.To4() != nil {
+					return fmt.Sprintf("target %s is not an IPv6 address", target)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func printPlan(plan []RegistryChange) {
+	for _, change := range plan {
+		fmt.Printf("TXT Record: %s\n", change.Name)
+		if change.OldValue != "" {
+			fmt.Printf("Old TXT Record Value: %s\n", change.OldValue)
+		}
+		if change.NewValue != "" {
+			fmt.Printf("New TXT Record Value: %s\n", change.NewValue)
+		}
+	}
+}
+
+func (c RegistryChange) change() dns.Change {
+	if c.NewValue == "" {
+		return dns.Change{Action: dns.DeleteRegistryAction, Name: c.Name}
+	}
+	return dns.Change{Action: dns.SetRegistryAction, Name: c.Name, Value: c.NewValue}
+}
+
+func registryChanges(plan []RegistryChange) dns.ChangeSet {
+	var ret dns.ChangeSet
+	for _, change := range plan {
+		ret = append(ret, change.change())
+	}
+	return ret
+}
+
+// apply applies the changes through the configured provider in batches and
+// reports the outcome of every batch
+func (conf *Config) apply(ctx context.Context, changes dns.ChangeSet) error {
+	var applied int
+	for i, result := range dns.Apply(ctx, conf.API, changes, conf.BatchSize) {
+		mode := "one at a time"
+		if result.Atomic {
+			mode = "atomically"
+		}
+		if result.Err != nil {
+			fmt.Printf("Batch %d: applied %d of %d changes %s before failing: %v\n", i+1, result.Applied, len(result.Changes), mode, result.Err)
+			for _, change := range result.Changes[result.Applied:] {
+				fmt.Printf("Not applied: %s\n", change)
+			}
+			return fmt.Errorf("Applied %d of %d changes before failing: %v", applied+result.Applied, len(changes), result.Err)
+		}
+		applied += result.Applied
+		fmt.Printf("Batch %d: applied %d changes %s\n", i+1, result.Applied, mode)
+	}
+	fmt.Printf("Applied %d changes\n", applied)
+	return nil
+}
+
+func confirm() bool {
+	fmt.Print("\nApply these changes? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,252 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+// fakeAPI is an in-memory zone. Every write is logged and writes to the TXT
+// registry records named in lost are accepted but not kept.
+type fakeAPI struct {
+	records []dns.Record
+	log     []string
+	lost    map[string]bool
+}
+
+func (f *fakeAPI) GetRecords(ctx context.Context) ([]dns.Record, error) {
+	var ret []dns.Record
+	for _, record := range f.records {
+		record.Targets = append([]string(nil), record.Targets...)
+		ret = append(ret, record)
+	}
+	return ret, nil
+}
+
+func (f *fakeAPI) SetRegistry(ctx context.Context, name, value string) error {
+	f.log = append(f.log, "set-registry "+name+" "+value)
+	if f.lost[name] {
+		return nil
+	}
+	f.removeRegistry(name)
+	f.records = append(f.records, dns.Record{Name: name, Type: "TXT", Targets: []string{dns.QuoteValue(value)}})
+	return nil
+}
+
+func (f *fakeAPI) DeleteRegistry(ctx context.Context, name string) error {
+	f.log = append(f.log, "delete-registry "+name)
+	f.removeRegistry(name)
+	return nil
+}
+
+func (f *fakeAPI) SetRecord(ctx context.Context, record dns.Record) error {
+	f.log = append(f.log, "set-record "+record.Name+" "+record.Type+" "+record.Target())
+	f.remove(record.Name, record.Type)
+	f.records = append(f.records, record)
+	return nil
+}
+
+func (f *fakeAPI) DeleteRecord(ctx context.Context, record dns.Record) error {
+	f.log = append(f.log, "delete-record "+record.Name+" "+record.Type)
+	f.remove(record.Name, record.Type)
+	return nil
+}
+
+func (f *fakeAPI) removeRegistry(name string) {
+	f.remove(name, "TXT")
+}
+
+func (f *fakeAPI) remove(name, recordType string) {
+	var kept []dns.Record
+	for _, item := range f.records {
+		if item.Name != name || item.Type != recordType {
+			kept = append(kept, item)
+		}
+	}
+	f.records = kept
+}
+
+// registry returns the registry values of the zone indexed by name
+func (f *fakeAPI) registry() map[string]string {
+	var ret = make(map[string]string)
+	for name, reg := range dns.ParseRegistry(f.records, nil) {
+		ret[name] = reg.Value()
+	}
+	return ret
+}
+
+func txt(name, value string) dns.Record {
+	return dns.Record{Name: name, Type: "TXT", Targets: []string{dns.QuoteValue(value)}}
+}
+
+func TestMigrateOwner(t *testing.T) {
+	api := &fakeAPI{records: []dns.Record{
+		txt("a.example.com", "heritage=external-dns,external-dns/owner=old,external-dns/resource=ingress/default/a,external-dns/extra=kept"),
+		txt("b.example.com", "heritage=external-dns,external-dns/owner=other,external-dns/resource=ingress/default/b"),
+		txt("c.example.com", "heritage=external-dns,external-dns/owner=old,external-dns/owner=old,external-dns/resource=ingress/default/c"),
+		txt("d.example.com", "heritage=external-dns,external-dns/owner=old"),
+	}}
+	conf := &Config{API: api, RegistryOwner: "old"}
+
+	if err := MigrateOwner(context.Background(), conf, "old", "new", true); err != nil {
+		t.Fatalf("MigrateOwner returned %v", err)
+	}
+	want := []string{
+		"set-registry a.example.com heritage=external-dns,external-dns/owner=new,external-dns/resource=ingress/default/a,external-dns/extra=kept",
+		"set-registry d.example.com heritage=external-dns,external-dns/owner=new",
+	}
+	if !reflect.DeepEqual(api.log, want) {
+		t.Errorf("MigrateOwner wrote\n%s\nwant\n%s", strings.Join(api.log, "\n"), strings.Join(want, "\n"))
+	}
+	if owner := dns.ParseRegistry(api.records, nil)["c.example.com"].Owner; owner != "old" {
+		t.Errorf("the malformed entry is owned by %s, want it left to old", owner)
+	}
+}
+
+func TestMigratePrefix(t *testing.T) {
+	zone := func() []dns.Record {
+		return []dns.Record{
+			{Name: "a.example.com", Type: "CNAME", Targets: []string{"lb.example.net"}},
+			{Name: "b.example.com", Type: "A", Targets: []string{"10.0.0.1"}},
+			{Name: "c.example.com", Type: "A", Targets: []string{"10.0.0.2"}},
+			txt("old.a.example.com", dns.RegistryValue("me", "ingress/default/a")),
+			txt("old.b.example.com", dns.RegistryValue("me", "service/default/b")),
+			txt("old.c.example.com", dns.RegistryValue("other", "service/default/c")),
+		}
+	}
+
+	api := &fakeAPI{records: zone()}
+	conf := &Config{API: api, RegistryOwner: "me"}
+	if err := MigratePrefix(context.Background(), conf, "old.", "new.", true, true); err != nil {
+		t.Fatalf("MigratePrefix returned %v", err)
+	}
+	want := []string{
+		"set-registry new.a.example.com " + dns.RegistryValue("me", "ingress/default/a"),
+		"set-registry new.b.example.com " + dns.RegistryValue("me", "service/default/b"),
+		"delete-registry old.a.example.com",
+		"delete-registry old.b.example.com",
+	}
+	if !reflect.DeepEqual(api.log, want) {
+		t.Errorf("MigratePrefix wrote\n%s\nwant\n%s", strings.Join(api.log, "\n"), strings.Join(want, "\n"))
+	}
+	registry := api.registry()
+	if _, exists := registry["old.c.example.com"]; !exists || len(registry) != 3 {
+		t.Errorf("the registry is %v, want the new entries and the entry of the other owner", registry)
+	}
+
+	api = &fakeAPI{records: zone(), lost: map[string]bool{"new.b.example.com": true}}
+	conf = &Config{API: api, RegistryOwner: "me"}
+	err := MigratePrefix(context.Background(), conf, "old.", "new.", true, true)
+	if err == nil {
+		t.Fatalf("MigratePrefix returned no error when new.b.example.com was not written")
+	}
+	for _, entry := range api.log {
+		if strings.HasPrefix(entry, "delete-registry") {
+			t.Errorf("MigratePrefix deleted a registry record after failing verification: %s", entry)
+		}
+	}
+	for _, name := range []string{"old.a.example.com", "old.b.example.com"} {
+		if _, exists := api.registry()[name]; !exists {
+			t.Errorf("%s is gone after failing verification", name)
+		}
+	}
+}
+
+func TestConflict(t *testing.T) {
+	record := dns.Record{Name: "a.example.com", Type: "A", Targets: []string{"1.1.1.1", "2.2.2.2"}}
+	cname := dns.Record{Name: "www.example.com", Type: "CNAME", Targets: []string{"lb.example.net"}}
+	tests := []struct {
+		name     string
+		record   dns.Record
+		existing []dns.Record
+		want     bool
+	}{
+		{"nothing there", record, nil, false},
+		{"same targets in another order", record, []dns.Record{{Type: "A", Targets: []string{"2.2.2.2", "1.1.1.1"}}}, false},
+		{"other targets", record, []dns.Record{{Type: "A", Targets: []string{"1.1.1.1"}}}, true},
+		{"record of another type", record, []dns.Record{{Type: "AAAA", Targets: []string{"::1"}}}, false},
+		{"cname with a trailing dot", cname, []dns.Record{{Type: "CNAME", Targets: []string{"LB.example.net."}}}, false},
+		{"cname elsewhere", cname, []dns.Record{{Type: "CNAME", Targets: []string{"other.example.net"}}}, true},
+		{"cname next to an A record", cname, []dns.Record{{Type: "A", Targets: []string{"1.1.1.1"}}}, true},
+	}
+	for _, test := range tests {
+		if got := conflict(test.record, test.existing); (got != "") != test.want {
+			t.Errorf("%s: conflict = %q, want a conflict: %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnrepresentable(t *testing.T) {
+	weighted := dns.Record{Type: "CNAME", Targets: []string{"lb.example.net"}, Metadata: map[string]string{dns.SetIdentifierMetadata: "blue"}}
+	tests := []struct {
+		name     string
+		record   dns.Record
+		provider string
+		want     bool
+	}{
+		{"plain A record", dns.Record{Type: "A", Targets: []string{"1.1.1.1"}}, "cloudflare", false},
+		{"IPv6 in an A record", dns.Record{Type: "A", Targets: []string{"::1"}}, "cloudflare", true},
+		{"IPv4 in an AAAA record", dns.Record{Type: "AAAA", Targets: []string{"1.1.1.1"}}, "clouddns", true},
+		{"alias", dns.Record{Type: "A", Targets: []string{"lb.elb.amazonaws.com"}, Metadata: map[string]string{dns.AliasMetadata: "true"}}, "cloudflare", true},
+		{"set identifier on cloudflare", weighted, "cloudflare", true},
+		{"set identifier on clouddns", weighted, "clouddns", true},
+		{"set identifier on route53", weighted, "route53", false},
+	}
+	for _, test := range tests {
+		if got := unrepresentable(test.record, test.provider); (got != "") != test.want {
+			t.Errorf("%s: unrepresentable = %q, want a reason: %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMigrateZoneTwice(t *testing.T) {
+	sourceAPI := &fakeAPI{records: []dns.Record{
+		{Name: "a.example.com.", Type: "A", Targets: []string{"1.1.1.1", "2.2.2.2"}},
+		{Name: "www.example.com.", Type: "CNAME", Targets: []string{"lb.example.net."}},
+		{Name: "w.example.com.", Type: "CNAME", Targets: []string{"blue.example.net"}, Metadata: map[string]string{dns.SetIdentifierMetadata: "blue"}},
+		{Name: "w.example.com.", Type: "CNAME", Targets: []string{"green.example.net"}, Metadata: map[string]string{dns.SetIdentifierMetadata: "green"}},
+		txt("a.example.com.", dns.RegistryValue("me", "service/default/a")),
+		txt("www.example.com.", dns.RegistryValue("me", "ingress/default/www")),
+		txt("w.example.com.", dns.RegistryValue("me", "ingress/default/w")),
+	}}
+	targetAPI := &fakeAPI{records: []dns.Record{
+		{Name: "a.example.com", Type: "A", Targets: []string{"2.2.2.2", "1.1.1.1"}},
+		{Name: "www.example.com", Type: "CNAME", Targets: []string{"lb.example.net"}},
+	}}
+	source := &Config{API: sourceAPI, Provider: "route53", RegistryOwner: "me"}
+	target := &Config{API: targetAPI, Provider: "cloudflare", RegistryOwner: "me"}
+
+	for i := 0; i < 2; i++ {
+		targetAPI.log = nil
+		if err := MigrateZone(context.Background(), source, target, true); err != nil {
+			t.Fatalf("MigrateZone returned %v", err)
+		}
+		var records []string
+		for _, entry := range targetAPI.log {
+			if strings.HasPrefix(entry, "set-record") {
+				records = append(records, entry)
+			}
+		}
+		want := []string{
+			"set-record a.example.com A 1.1.1.1,2.2.2.2",
+			"set-record www.example.com CNAME lb.example.net.",
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("run %d of MigrateZone wrote\n%s\nwant\n%s", i+1, strings.Join(records, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
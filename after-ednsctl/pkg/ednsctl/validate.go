@@ -0,0 +1,408 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/kubernetes"
+)
+
+// Validation holds the differences found between a DNS zone and the cluster
+type Validation struct {
+	Deletable     []dns.Record
+	WrongRegistry map[string]dns.RegistryRecord
+	NoRegistry    kubernetes.Hostnames
+	Malformed     []dns.RegistryRecord
+	StaleTargets  []StaleTarget
+	Orphaned      []Orphan
+	Endpoints     []EndpointMismatch
+	Annotations   []AnnotationMismatch
+	Records       map[string][]dns.Record // Records holds every record in the zone indexed by name
+}
+
+// StaleTarget is an owned record that does not point to the load balancer of
+// the resource its TXT registry record belongs to
+type StaleTarget struct {
+	Record   dns.Record
+	Resource kubernetes.Resource
+}
+
+// Orphan is an owned TXT registry record whose resource label does not match
+// a resource declaring the hostname. external-dns never cleans those up.
+type Orphan struct {
+	Registry dns.RegistryRecord
+	Reason   string
+}
+
+// EndpointMismatch is a record declared by a DNSEndpoint that is missing from
+// the zone or differs from the declaration
+type EndpointMismatch struct {
+	Resource kubernetes.Resource
+	Reason   string
+}
+
+// AnnotationMismatch is an owned record that differs from the record the
+// external-dns annotations of its resource ask for
+type AnnotationMismatch struct {
+	Record   dns.Record
+	Resource kubernetes.Resource
+	Reason   string
+}
+
+// Validate compares the records and TXT registry of the configured provider
+// with the hostnames found in the cluster and prints the differences. With fix
+// set the missing TXT registry records are created once confirmed, or straight
+// away if assumeYes is set. Deletable records are never deleted, they have no TXT
+// registry record so nothing shows they are owned by the configured owner.
+func Validate(ctx context.Context, conf *Config, fix, assumeYes bool) error {
+	err := conf.configure(ctx)
+	if err != nil {
+		return err
+	}
+	hosts, err := conf.Kube.GetHosts(ctx)
+	if err != nil {
+		return err
+	}
+	records, registry, err := conf.readZone(ctx)
+	if err != nil {
+		return err
+	}
+	v := conf.compare(records, registry, hosts, conf.Kube)
+	conf.output(v)
+	if !fix {
+		return nil
+	}
+	return conf.fix(ctx, v, assumeYes)
+}
+
+func (conf *Config) compare(records []dns.Record, registry map[string]dns.RegistryRecord, hosts kubernetes.Hostnames, kube *kubernetes.Kube) *Validation {
+	var ret = Validation{
+		WrongRegistry: make(map[string]dns.RegistryRecord),
+		NoRegistry:    make(kubernetes.Hostnames),
+		Records:       make(map[string][]dns.Record),
+	}
+	for _, record := range records {
+		ret.Records[record.Name] = append(ret.Records[record.Name], record)
+	}
+	for _, name := range sortedKeys(registry) {
+		reg := registry[name]
+		if len(reg.Problems) > 0 {
+			ret.Malformed = append(ret.Malformed, reg)
+		}
+		if reg.Owner != conf.RegistryOwner || reg.Resource == "" {
+			continue
+		}
+		host, _, _, ok := conf.registryNames().Resolve(name)
+		if !ok || kube.IsIgnored(host) {
+			continue
+		}
+		if reason := resourceMismatch(reg, hosts[kubernetes.Hostname(host)], kube.Resources); reason != "" {
+			ret.Orphaned = append(ret.Orphaned, Orphan{Registry: reg, Reason: reason})
+		}
+	}
+	for _, hostname := range hosts.Sorted() {
+		for _, resource := range hosts[hostname] {
+			if resource.Endpoint == nil || !dns.IsRecordType(resource.Endpoint.RecordType) {
+				continue
+			}
+			if reason := endpointMismatch(*resource.Endpoint, ret.Records[string(hostname)]); reason != "" {
+				ret.Endpoints = append(ret.Endpoints, EndpointMismatch{Resource: resource, Reason: reason})
+			}
+		}
+	}
+	for hostname, resources := range hosts {
+		host := string(hostname)
+		if reg, exists := conf.registryNames().Lookup(registry, host, ""); exists {
+			if reg.Owner != conf.RegistryOwner {
+				ret.WrongRegistry[host] = reg
+			}
+			continue
+		}
+		if reg, exists := conf.unaffixedNames().Lookup(registry, host, ""); exists {
+			ret.WrongRegistry[host] = reg
+			continue
+		}
+		ret.NoRegistry[hostname] = resources
+	}
+	var resources = make(map[string]kubernetes.Resource)
+	for _, items := range hosts {
+		for _, resource := range items {
+			resources[resource.String()] = resource
+		}
+	}
+	for _, record := range records {
+		if reg, exists := conf.registryNames().Lookup(registry, record.Name, record.Type); exists {
+			resource, exists := findResource(hosts[kubernetes.Hostname(record.Name)], reg.Resource)
+			if !exists {
+				resource, exists = resources[reg.Resource]
+			}
+			if !exists || reg.Owner != conf.RegistryOwner {
+				continue
+			}
+			if isStale(record, resource) {
+				ret.StaleTargets = append(ret.StaleTargets, StaleTarget{Record: record, Resource: resource})
+			}
+			if reason := conf.annotationMismatch(record, resource); reason != "" {
+				ret.Annotations = append(ret.Annotations, AnnotationMismatch{Record: record, Resource: resource, Reason: reason})
+			}
+			continue
+		}
+		if _, exists := hosts[kubernetes.Hostname(record.Name)]; exists {
+			continue
+		}
+		for _, target := range record.Targets {
+			if isValidTarget(target, kube.ValidTargets) {
+				ret.Deletable = append(ret.Deletable, record)
+				break
+			}
+		}
+	}
+	sort.SliceStable(ret.Deletable, func(i, j int) bool {
+		return ret.Deletable[i].Name < ret.Deletable[j].Name
+	})
+	return &ret
+}
+
+// resourceMismatch describes how the resource label of the registry record
+// differs from the resources declaring its hostname, or returns an empty string
+// if one of them is the labelled resource. Kinds GetHosts does not look at are
+// not checked.
+func resourceMismatch(reg dns.RegistryRecord, declaring []kubernetes.Resource, resources map[string]kubernetes.Resource) string {
+	kind, namespace, name := reg.SplitResource()
+	if !kubernetes.HasKind(kind) {
+		return ""
+	}
+	for _, resource := range declaring {
+		if resource.String() == reg.Resource {
+			return ""
+		}
+	}
+	for _, resource := range declaring {
+		if resource.Name == name && (resource.Kind != kind || resource.Namespace != namespace) {
+			return fmt.Sprintf("the hostname is declared by %s instead", resource.String())
+		}
+	}
+	if _, exists := resources[reg.Resource]; exists {
+		return fmt.Sprintf("%s no longer declares the hostname", reg.Resource)
+	}
+	return fmt.Sprintf("%s does not exist", reg.Resource)
+}
+
+// endpointMismatch describes how the record in the zone differs from the one
+// declared by the endpoint, or returns an empty string if they match. The TTL
+// is only compared when the endpoint sets one.
+func endpointMismatch(endpoint kubernetes.Endpoint, records []dns.Record) string {
+	for _, record := range records {
+		if !strings.EqualFold(record.Type, endpoint.RecordType) {
+			continue
+		}
+		if !sameTargets(record.Targets, endpoint.Targets) {
+			return fmt.Sprintf("the targets are %s instead of %s", record.Target(), strings.Join(endpoint.Targets, ","))
+		}
+		if endpoint.TTL > 0 && record.TTL != endpoint.TTL {
+			return fmt.Sprintf("the TTL is %d instead of %d", record.TTL, endpoint.TTL)
+		}
+		return ""
+	}
+	return fmt.Sprintf("the %s record does not exist", strings.ToUpper(endpoint.RecordType))
+}
+
+// sameTargets reports whether both lists hold the same targets in any order
+func sameTargets(targets, declared []string) bool {
+	normalize := func(values []string) []string {
+		var ret []string
+		for _, value := range values {
+			ret = append(ret, targetCandidates(value)[0])
+		}
+		sort.Strings(ret)
+		return ret
+	}
+	return strings.Join(normalize(targets), ",") == strings.Join(normalize(declared), ",")
+}
+
+// annotationMismatch describes how the record differs from the TTL, alias and
+// set identifier annotations of its resource, or returns an empty string if it
+// does not. Only route53 supports alias records and set identifiers.
+func (conf *Config) annotationMismatch(record dns.Record, resource kubernetes.Resource) string {
+	if resource.Endpoint != nil {
+		return ""
+	}
+	if resource.TTL > 0 && !record.Alias() && record.TTL != resource.TTL {
+		return fmt.Sprintf("the TTL is %d instead of %d", record.TTL, resource.TTL)
+	}
+	if conf.Provider != "route53" {
+		return ""
+	}
+	if resource.Alias && record.Type == "CNAME" {
+		return "the record is a CNAME instead of an alias"
+	}
+	if setIdentifier := record.Metadata[dns.SetIdentifierMetadata]; setIdentifier != resource.SetIdentifier {
+		return fmt.Sprintf("the set identifier is %s instead of %s", valueOrNone(setIdentifier), valueOrNone(resource.SetIdentifier))
+	}
+	return ""
+}
+
+// findResource returns the resource with the given kind/namespace/name
+func findResource(resources []kubernetes.Resource, name string) (kubernetes.Resource, bool) {
+	for _, resource := range resources {
+		if resource.String() == name {
+			return resource, true
+		}
+	}
+	return kubernetes.Resource{}, false
+}
+
+// isValidTarget reports whether the record target points at a load balancer
+// of the cluster
+func isValidTarget(target string, validTargets map[string][]string) bool {
+	for _, candidate := range targetCandidates(target) {
+		if _, exists := validTargets[candidate]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// isStale reports whether none of the targets of the record is one of the load
+// balancers of the resource. Records are only compared with resources whose
+// load balancers are known, and IP records only with the IPs among them.
+func isStale(record dns.Record, resource kubernetes.Resource) bool {
+	var wanted = make(map[string]bool)
+	for _, target := range resource.Targets {
+		if net.ParseIP(target) == nil && (record.Type == "A" || record.Type == "AAAA") && !record.Alias() {
+			continue
+		}
+		wanted[strings.ToLower(target)] = true
+	}
+	if len(wanted) == 0 {
+		return false
+	}
+	for _, target := range record.Targets {
+		for _, candidate := range targetCandidates(target) {
+			if wanted[candidate] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// targetCandidates returns the load balancer names a record target may stand
+// for. CNAME and alias targets may end with a dot and route53 alias targets to
+// ELBs get a dualstack. prefix.
+func targetCandidates(target string) []string {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	return []string{target, strings.TrimPrefix(target, "dualstack.")}
+}
+
+func (conf *Config) output(v *Validation) {
+	fmt.Printf("The following records can be deleted (%d items)\n", len(v.Deletable))
+	for _, record := range v.Deletable {
+		fmt.Printf("Record: %s %s %s\n", record.Name, record.DisplayType(), record.Target())
+	}
+
+	fmt.Printf("\nThe following records belong to the incorrect TXT registry (%d items)\n", len(v.WrongRegistry))
+	for _, host := range sortedKeys(v.WrongRegistry) {
+		fmt.Printf("Record: %s %s\n", host, v.recordTypes(host))
+		fmt.Printf("External TXT Record: %s (owner: %s, format: %s)\n", v.WrongRegistry[host].Name, v.WrongRegistry[host].Owner, v.WrongRegistry[host].Format)
+	}
+
+	fmt.Printf("\nThe following records need TXT registry records added (%d items)\n", len(v.NoRegistry))
+	for _, host := range v.NoRegistry.Sorted() {
+		resource := v.NoRegistry[host][0]
+		fmt.Printf("Record: %s %s\n", string(host), v.recordTypes(string(host)))
+		fmt.Printf("TXT Record: %s\n", conf.registryNames().RegistryName(string(host), "", dns.LegacyFormat))
+		fmt.Printf("TXT Record Value: %s\n", dns.RegistryValue(conf.RegistryOwner, resource.String()))
+	}
+
+	fmt.Printf("\nThe following records do not point to the load balancer of their resource (%d items)\n", len(v.StaleTargets))
+	for _, stale := range v.StaleTargets {
+		fmt.Printf("Record: %s %s %s\n", stale.Record.Name, stale.Record.DisplayType(), stale.Record.Target())
+		fmt.Printf("Resource: %s (targets: %s)\n", stale.Resource.String(), strings.Join(stale.Resource.Targets, ","))
+	}
+
+	fmt.Printf("\nThe following TXT registry records reference resources that do not declare their hostname (%d items)\n", len(v.Orphaned))
+	for _, orphan := range v.Orphaned {
+		fmt.Printf("TXT Record: %s\n", orphan.Registry.Name)
+		fmt.Printf("Resource: %s\n", orphan.Registry.Resource)
+		fmt.Printf("Reason: %s\n", orphan.Reason)
+	}
+
+	fmt.Printf("\nThe following records do not match their DNSEndpoint (%d items)\n", len(v.Endpoints))
+	for _, mismatch := range v.Endpoints {
+		fmt.Printf("Record: %s %s\n", mismatch.Resource.Endpoint.DNSName, mismatch.Resource.Endpoint.RecordType)
+		fmt.Printf("Resource: %s\n", mismatch.Resource.String())
+		fmt.Printf("Reason: %s\n", mismatch.Reason)
+	}
+
+	fmt.Printf("\nThe following records do not match the annotations of their resource (%d items)\n", len(v.Annotations))
+	for _, mismatch := range v.Annotations {
+		fmt.Printf("Record: %s %s %s\n", mismatch.Record.Name, mismatch.Record.DisplayType(), mismatch.Record.Target())
+		fmt.Printf("Resource: %s\n", mismatch.Resource.String())
+		fmt.Printf("Reason: %s\n", mismatch.Reason)
+	}
+
+	fmt.Printf("\nThe following TXT registry records are malformed (%d items)\n", len(v.Malformed))
+	for _, reg := range v.Malformed {
+		fmt.Printf("TXT Record: %s\n", reg.Name)
+		for _, problem := range reg.Problems {
+			fmt.Printf("Problem: %s\n", problem)
+		}
+	}
+}
+
+func (conf *Config) fix(ctx context.Context, v *Validation, assumeYes bool) error {
+	var plan []RegistryChange
+	for _, host := range v.NoRegistry.Sorted() {
+		plan = append(plan, RegistryChange{
+			Name:     conf.registryNames().RegistryName(string(host), "", dns.LegacyFormat),
+			NewValue: dns.RegistryValue(conf.RegistryOwner, v.NoRegistry[host][0].String()),
+		})
+	}
+	if len(v.Deletable) > 0 {
+		fmt.Printf("\nThe %d deletable records are not registered to %s and have to be deleted by hand\n", len(v.Deletable), conf.RegistryOwner)
+	}
+	if len(plan) == 0 {
+		fmt.Println("\nNothing to fix")
+		return nil
+	}
+	fmt.Printf("\nThe fix will add %d TXT registry records\n", len(plan))
+	if !assumeYes && !confirm() {
+		fmt.Println("Aborted, no changes were made")
+		return nil
+	}
+	return conf.apply(ctx, registryChanges(plan))
+}
+
+// recordTypes returns the types of the records with the given name separated by commas
+func (v *Validation) recordTypes(name string) string {
+	var types []string
+	for _, record := range v.Records[name] {
+		types = append(types, record.DisplayType())
+	}
+	return valueOrNone(strings.Join(types, ","))
+}
+
+func sortedKeys(m map[string]dns.RegistryRecord) []string {
+	var ret []string
+	for key := range m {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,241 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ednsctl
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/kubernetes"
+)
+
+func TestIsStale(t *testing.T) {
+	alias := map[string]string{dns.AliasMetadata: "true"}
+	tests := []struct {
+		name    string
+		record  dns.Record
+		targets []string
+		want    bool
+	}{
+		{
+			name:    "cname to the load balancer",
+			record:  dns.Record{Type: "CNAME", Targets: []string{"LB-1.elb.amazonaws.com."}},
+			targets: []string{"lb-1.elb.amazonaws.com"},
+		},
+		{
+			name:    "cname to another load balancer",
+			record:  dns.Record{Type: "CNAME", Targets: []string{"lb-2.elb.amazonaws.com"}},
+			targets: []string{"lb-1.elb.amazonaws.com"},
+			want:    true,
+		},
+		{
+			name:    "alias to a dualstack load balancer",
+			record:  dns.Record{Type: "A", Targets: []string{"dualstack.lb-1.elb.amazonaws.com"}, Metadata: alias},
+			targets: []string{"lb-1.elb.amazonaws.com"},
+		},
+		{
+			name:    "A record to one of several IPs",
+			record:  dns.Record{Type: "A", Targets: []string{"10.0.0.2"}},
+			targets: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:    "A record to none of several IPs",
+			record:  dns.Record{Type: "A", Targets: []string{"10.0.0.3"}},
+			targets: []string{"10.0.0.1", "10.0.0.2"},
+			want:    true,
+		},
+		{
+			name:    "A record to an IP of a resource behind a hostname",
+			record:  dns.Record{Type: "A", Targets: []string{"10.0.0.3"}},
+			targets: []string{"lb-1.elb.amazonaws.com"},
+		},
+		{
+			name:    "A record compared with the IPs of a mixed resource",
+			record:  dns.Record{Type: "A", Targets: []string{"10.0.0.3"}},
+			targets: []string{"lb-1.elb.amazonaws.com", "10.0.0.1"},
+			want:    true,
+		},
+		{
+			name:   "resource without targets",
+			record: dns.Record{Type: "CNAME", Targets: []string{"lb-2.elb.amazonaws.com"}},
+		},
+	}
+	for _, test := range tests {
+		if got := isStale(test.record, kubernetes.Resource{Targets: test.targets}); got != test.want {
+			t.Errorf("%s: isStale = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	web := kubernetes.Resource{Kind: "ingress", Namespace: "default", Name: "web", Targets: []string{"lb-web.elb.amazonaws.com"}}
+	cname := func(name, target string) dns.Record {
+		return dns.Record{Name: name, Type: "CNAME", Targets: []string{target}}
+	}
+	owned := func(name string) dns.RegistryRecord {
+		return dns.RegistryRecord{Name: name, Owner: "me", Resource: web.String()}
+	}
+	tests := []struct {
+		name      string
+		records   []dns.Record
+		registry  []dns.RegistryRecord
+		hosts     []string
+		deletable []string
+		wrong     map[string]string // wrong maps hostnames to the name of the registry record they belong to
+		none      []string
+	}{
+		{
+			name:     "prefixed registry owned by us",
+			records:  []dns.Record{cname("a.example.com", "lb-web.elb.amazonaws.com")},
+			registry: []dns.RegistryRecord{owned("txt.a.example.com")},
+			hosts:    []string{"a.example.com"},
+		},
+		{
+			name:     "prefixed record type registry owned by us",
+			records:  []dns.Record{cname("a.example.com", "lb-web.elb.amazonaws.com")},
+			registry: []dns.RegistryRecord{owned("txt.cname-a.example.com")},
+			hosts:    []string{"a.example.com"},
+		},
+		{
+			name:     "unprefixed registry",
+			records:  []dns.Record{cname("b.example.com", "lb-web.elb.amazonaws.com")},
+			registry: []dns.RegistryRecord{owned("b.example.com")},
+			hosts:    []string{"b.example.com"},
+			wrong:    map[string]string{"b.example.com": "b.example.com"},
+		},
+		{
+			name:     "registry of another owner",
+			records:  []dns.Record{cname("c.example.com", "lb-web.elb.amazonaws.com")},
+			registry: []dns.RegistryRecord{{Name: "txt.c.example.com", Owner: "someone-else"}},
+			hosts:    []string{"c.example.com"},
+			wrong:    map[string]string{"c.example.com": "txt.c.example.com"},
+		},
+		{
+			name:    "hostname without registry",
+			records: []dns.Record{cname("d.example.com", "lb-web.elb.amazonaws.com")},
+			hosts:   []string{"d.example.com", "new.example.com"},
+			none:    []string{"d.example.com", "new.example.com"},
+		},
+		{
+			name: "unregistered records no resource declares",
+			records: []dns.Record{
+				cname("e.example.com", "lb-web.elb.amazonaws.com."),
+				cname("f.example.com", "elsewhere.example.net"),
+				{Name: "g.example.com", Type: "A", Targets: []string{"10.0.0.1", "lb-web.elb.amazonaws.com"}},
+			},
+			deletable: []string{"e.example.com", "g.example.com"},
+		},
+		{
+			name:     "registered records no resource declares",
+			records:  []dns.Record{cname("h.example.com", "lb-web.elb.amazonaws.com"), cname("i.example.com", "lb-web.elb.amazonaws.com")},
+			registry: []dns.RegistryRecord{owned("txt.h.example.com"), {Name: "txt.i.example.com", Owner: "someone-else"}},
+		},
+	}
+	for _, test := range tests {
+		conf := &Config{RegistryOwner: "me", RegistryPrefix: "txt."}
+		kube := &kubernetes.Kube{
+			Resources:    map[string]kubernetes.Resource{web.String(): web},
+			ValidTargets: map[string][]string{"lb-web.elb.amazonaws.com": {"ingress/web"}},
+		}
+		registry := make(map[string]dns.RegistryRecord)
+		for _, reg := range test.registry {
+			registry[reg.Name] = reg
+		}
+		hosts := make(kubernetes.Hostnames)
+		for _, host := range test.hosts {
+			hosts[kubernetes.Hostname(host)] = []kubernetes.Resource{web}
+		}
+
+		v := conf.compare(test.records, registry, hosts, kube)
+		var deletable []string
+		for _, record := range v.Deletable {
+			deletable = append(deletable, record.Name)
+		}
+		if !reflect.DeepEqual(deletable, test.deletable) {
+			t.Errorf("%s: Deletable = %v, want %v", test.name, deletable, test.deletable)
+		}
+		var wrong = make(map[string]string)
+		for host, reg := range v.WrongRegistry {
+			wrong[host] = reg.Name
+		}
+		if len(wrong) > 0 || len(test.wrong) > 0 {
+			if !reflect.DeepEqual(wrong, test.wrong) {
+				t.Errorf("%s: WrongRegistry = %v, want %v", test.name, wrong, test.wrong)
+			}
+		}
+		var none []string
+		for host := range v.NoRegistry {
+			none = append(none, string(host))
+		}
+		sort.Strings(none)
+		if !reflect.DeepEqual(none, test.none) {
+			t.Errorf("%s: NoRegistry = %v, want %v", test.name, none, test.none)
+		}
+	}
+}
+
+func TestResourceMismatch(t *testing.T) {
+	web := kubernetes.Resource{Kind: "ingress", Namespace: "default", Name: "web"}
+	api := kubernetes.Resource{Kind: "ingress", Namespace: "default", Name: "api"}
+	resources := map[string]kubernetes.Resource{web.String(): web, api.String(): api}
+	tests := []struct {
+		name      string
+		resource  string
+		declaring []kubernetes.Resource
+		want      string
+	}{
+		{name: "still declared", resource: "ingress/default/web", declaring: []kubernetes.Resource{api, web}},
+		{name: "resource missing", resource: "ingress/default/gone", declaring: []kubernetes.Resource{web}, want: "ingress/default/gone does not exist"},
+		{name: "resource missing and nothing declares", resource: "ingress/default/gone", want: "ingress/default/gone does not exist"},
+		{name: "kind changed", resource: "service/default/web", declaring: []kubernetes.Resource{web}, want: "the hostname is declared by ingress/default/web instead"},
+		{name: "namespace changed", resource: "ingress/old/web", declaring: []kubernetes.Resource{web}, want: "the hostname is declared by ingress/default/web instead"},
+		{name: "no longer declares", resource: "ingress/default/api", declaring: []kubernetes.Resource{web}, want: "ingress/default/api no longer declares the hostname"},
+		{name: "kind not looked at", resource: "pod/default/web", declaring: []kubernetes.Resource{web}},
+		{name: "no kind", resource: "web", declaring: []kubernetes.Resource{web}},
+	}
+	for _, test := range tests {
+		reg := dns.RegistryRecord{Name: "txt.a.example.com", Resource: test.resource}
+		if got := resourceMismatch(reg, test.declaring, resources); got != test.want {
+			t.Errorf("%s: resourceMismatch = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEndpointMismatch(t *testing.T) {
+	records := []dns.Record{
+		{Name: "a.example.com", Type: "A", TTL: 300, Targets: []string{"10.0.0.1", "10.0.0.2"}},
+		{Name: "a.example.com", Type: "CNAME", TTL: 60, Targets: []string{"lb.example.net."}},
+	}
+	tests := []struct {
+		name     string
+		endpoint kubernetes.Endpoint
+		want     string
+	}{
+		{name: "same targets", endpoint: kubernetes.Endpoint{RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2"}, TTL: 300}},
+		{name: "reordered targets", endpoint: kubernetes.Endpoint{RecordType: "A", Targets: []string{"10.0.0.2", "10.0.0.1"}}},
+		{name: "lowercase record type", endpoint: kubernetes.Endpoint{RecordType: "a", Targets: []string{"10.0.0.1", "10.0.0.2"}}},
+		{name: "target without trailing dot", endpoint: kubernetes.Endpoint{RecordType: "CNAME", Targets: []string{"lb.example.net"}}},
+		{name: "missing record type", endpoint: kubernetes.Endpoint{RecordType: "aaaa", Targets: []string{"::1"}}, want: "the AAAA record does not exist"},
+		{name: "missing target", endpoint: kubernetes.Endpoint{RecordType: "A", Targets: []string{"10.0.0.1"}}, want: "the targets are 10.0.0.1,10.0.0.2 instead of 10.0.0.1"},
+		{name: "other target", endpoint: kubernetes.Endpoint{RecordType: "CNAME", Targets: []string{"lb2.example.net"}}, want: "the targets are lb.example.net. instead of lb2.example.net"},
+		{name: "TTL left to the provider", endpoint: kubernetes.Endpoint{RecordType: "CNAME", Targets: []string{"lb.example.net"}, TTL: 0}},
+		{name: "other TTL", endpoint: kubernetes.Endpoint{RecordType: "CNAME", Targets: []string{"lb.example.net"}, TTL: 300}, want: "the TTL is 60 instead of 300"},
+	}
+	for _, test := range tests {
+		test.endpoint.DNSName = "a.example.com"
+		if got := endpointMismatch(test.endpoint, records); got != test.want {
+			t.Errorf("%s: endpointMismatch = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
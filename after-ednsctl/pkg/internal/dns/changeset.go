@@ -0,0 +1,140 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultBatchSize is the number of changes applied together when no batch size is given
+const DefaultBatchSize = 100
+
+// ChangeAction is the kind of modification a Change makes to the zone
+type ChangeAction string
+
+const (
+	// SetRecordAction creates or replaces Record
+	SetRecordAction ChangeAction = "set-record"
+	// DeleteRecordAction deletes Record
+	DeleteRecordAction ChangeAction = "delete-record"
+	// SetRegistryAction creates or replaces the TXT registry record Name with Value
+	SetRegistryAction ChangeAction = "set-registry"
+	// DeleteRegistryAction deletes the TXT registry record Name
+	DeleteRegistryAction ChangeAction = "delete-registry"
+)
+
+// Change is a single modification of the zone. Record is used by the record
+// actions while Name and Value are used by the registry actions.
+type Change struct {
+	Action ChangeAction
+	Record Record
+	Name   string
+	Value  string
+}
+
+// String describes the change for reports
+func (c Change) String() string {
+	switch c.Action {
+	case SetRecordAction, DeleteRecordAction:
+		{
+			return fmt.Sprintf("%s %s %s %s", c.Action, c.Record.Type, c.Record.Name, c.Record.Target())
+		}
+	default:
+		{
+			return fmt.Sprintf("%s TXT %s %s", c.Action, c.Name, c.Value)
+		}
+	}
+}
+
+// ChangeSet is an ordered list of changes to a zone
+type ChangeSet []Change
+
+// Batcher is implemented by providers that can apply several changes in a
+// single atomic request
+type Batcher interface {
+	// ApplyBatch applies every change or none of them
+	ApplyBatch(ctx context.Context, changes []Change) error
+}
+
+// BatchResult reports the outcome of applying one batch of a ChangeSet
+type BatchResult struct {
+	Atomic  bool // Atomic is set when the batch was applied in a single request
+	Applied int
+	Changes []Change
+	Err     error
+}
+
+// Apply applies the change set through the API in batches of at most batchSize
+// changes. Providers implementing Batcher apply each batch atomically, others
+// apply the changes one at a time. Applying stops at the first failed batch.
+func Apply(ctx context.Context, api API, changes ChangeSet, batchSize int) []BatchResult {
+	var ret []BatchResult
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	batcher, atomic := api.(Batcher)
+	for start := 0; start < len(changes); start += batchSize {
+		end := start + batchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+		result := BatchResult{
+			Atomic:  atomic,
+			Changes: changes[start:end],
+		}
+		if atomic {
+			result.Err = batcher.ApplyBatch(ctx, result.Changes)
+			if result.Err == nil {
+				result.Applied = len(result.Changes)
+			}
+		} else {
+			for _, change := range result.Changes {
+				result.Err = applyChange(ctx, api, change)
+				if result.Err != nil {
+					break
+				}
+				result.Applied++
+			}
+		}
+		ret = append(ret, result)
+		if result.Err != nil {
+			break
+		}
+	}
+	return ret
+}
+
+func applyChange(ctx context.Context, api API, change Change) error {
+	switch change.Action {
+	case SetRecordAction:
+		{
+			return api.SetRecord(ctx, change.Record)
+		}
+	case DeleteRecordAction:
+		{
+			return api.DeleteRecord(ctx, change.Record)
+		}
+	case SetRegistryAction:
+		{
+			return api.SetRegistry(ctx, change.Name, change.Value)
+		}
+	case DeleteRegistryAction:
+		{
+			return api.DeleteRegistry(ctx, change.Name)
+		}
+	default:
+		{
+			return fmt.Errorf("Unknown change action: %s", change.Action)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var errFailed = errors.New("failed")
+
+// sequentialAPI applies changes one at a time and fails the change of the
+// registry record named fail
+type sequentialAPI struct {
+	applied []string
+	fail    string
+}
+
+func (a *sequentialAPI) GetRecords(ctx context.Context) ([]Record, error) {
+	return nil, nil
+}
+
+func (a *sequentialAPI) SetRegistry(ctx context.Context, name, value string) error {
+	if name == a.fail {
+		return errFailed
+	}
+	a.applied = append(a.applied, name)
+	return nil
+}
+
+func (a *sequentialAPI) DeleteRegistry(ctx context.Context, name string) error {
+	return a.SetRegistry(ctx, name, "")
+}
+
+func (a *sequentialAPI) SetRecord(ctx context.Context, record Record) error {
+	return a.SetRegistry(ctx, record.Name, "")
+}
+
+func (a *sequentialAPI) DeleteRecord(ctx context.Context, record Record) error {
+	return a.SetRegistry(ctx, record.Name, "")
+}
+
+// batchingAPI applies whole batches and fails the batch containing the change
+// of the registry record named fail
+type batchingAPI struct {
+	sequentialAPI
+	batches [][]string
+}
+
+func (a *batchingAPI) ApplyBatch(ctx context.Context, changes []Change) error {
+	var names []string
+	for _, change := range changes {
+		if change.Name == a.fail {
+			return errFailed
+		}
+		names = append(names, change.Name)
+	}
+	a.batches = append(a.batches, names)
+	return nil
+}
+
+func testChanges(count int) ChangeSet {
+	var ret ChangeSet
+	for i := 0; i < count; i++ {
+		ret = append(ret, Change{Action: SetRegistryAction, Name: fmt.Sprintf("r%d", i)})
+	}
+	return ret
+}
+
+func TestApplySplitsBatches(t *testing.T) {
+	tests := []struct {
+		changes   int
+		batchSize int
+		want      [][]string
+	}{
+		{5, 2, [][]string{{"r0", "r1"}, {"r2", "r3"}, {"r4"}}},
+		{4, 2, [][]string{{"r0", "r1"}, {"r2", "r3"}}},
+		{3, 5, [][]string{{"r0", "r1", "r2"}}},
+		{3, 0, [][]string{{"r0", "r1", "r2"}}},
+		{0, 2, nil},
+	}
+	for _, test := range tests {
+		api := &batchingAPI{}
+		results := Apply(context.Background(), api, testChanges(test.changes), test.batchSize)
+		if !reflect.DeepEqual(api.batches, test.want) {
+			t.Errorf("%d changes in batches of %d were applied as %v, want %v", test.changes, test.batchSize, api.batches, test.want)
+		}
+		if len(results) != len(test.want) {
+			t.Fatalf("%d changes in batches of %d returned %d results, want %d", test.changes, test.batchSize, len(results), len(test.want))
+		}
+		for i, result := range results {
+			if !result.Atomic || result.Err != nil || result.Applied != len(test.want[i]) || len(result.Changes) != len(test.want[i]) {
+				t.Errorf("batch %d returned %+v, want %d atomically applied changes", i, result, len(test.want[i]))
+			}
+		}
+	}
+}
+
+func TestApplyStopsAtTheFirstFailedBatch(t *testing.T) {
+	api := &batchingAPI{sequentialAPI: sequentialAPI{fail: "r3"}}
+	results := Apply(context.Background(), api, testChanges(7), 2)
+	if len(results) != 2 {
+		t.Fatalf("Apply returned %d results, want 2", len(results))
+	}
+	if results[0].Err != nil || results[0].Applied != 2 {
+		t.Errorf("the first batch returned %+v, want 2 applied changes", results[0])
+	}
+	if !errors.Is(results[1].Err, errFailed) || results[1].Applied != 0 {
+		t.Errorf("the failed batch returned %+v, want no applied changes and its error", results[1])
+	}
+	if want := [][]string{{"r0", "r1"}}; !reflect.DeepEqual(api.batches, want) {
+		t.Errorf("the batches applied are %v, want %v", api.batches, want)
+	}
+}
+
+func TestApplySequentially(t *testing.T) {
+	api := &sequentialAPI{fail: "r3"}
+	changes := ChangeSet{
+		{Action: SetRecordAction, Record: Record{Name: "r0"}},
+		{Action: DeleteRecordAction, Record: Record{Name: "r1"}},
+		{Action: DeleteRegistryAction, Name: "r2"},
+		{Action: SetRegistryAction, Name: "r3"},
+		{Action: SetRegistryAction, Name: "r4"},
+	}
+	results := Apply(context.Background(), api, changes, 2)
+	if len(results) != 2 {
+		t.Fatalf("Apply returned %d results, want 2", len(results))
+	}
+	if results[0].Atomic || results[0].Err != nil || results[0].Applied != 2 {
+		t.Errorf("the first batch returned %+v, want 2 changes applied one at a time", results[0])
+	}
+	// the change before the failed one was made even though the batch failed
+	if results[1].Atomic || !errors.Is(results[1].Err, errFailed) || results[1].Applied != 1 {
+		t.Errorf("the failed batch returned %+v, want 1 change applied one at a time and its error", results[1])
+	}
+	if want := []string{"r0", "r1", "r2"}; !reflect.DeepEqual(api.applied, want) {
+		t.Errorf("the changes applied are %v, want %v", api.applied, want)
+	}
+
+	results = Apply(context.Background(), &sequentialAPI{}, ChangeSet{{Action: "rename"}}, 2)
+	if len(results) != 1 || results[0].Err == nil || results[0].Applied != 0 {
+		t.Errorf("an unknown action returned %+v, want an error", results)
+	}
+}
@@ -11,24 +11,259 @@
 
 package clouddns
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+	clouddns "google.golang.org/api/dns/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// ProjectKey is the ProviderSpecificConfig key holding the GCP project
+	ProjectKey string = "project"
+	// ManagedZoneKey is the ProviderSpecificConfig key holding the managed zone name
+	ManagedZoneKey string = "managed-zone"
+
+	provider string = "clouddns"
+)
+
 // API represents a connection to clouddns
 type API struct {
+	Service     *clouddns.Service
+	Project     string
+	ManagedZone string
+	RegistryKey []byte
+	// recordSets holds the listing of the last GetRecords call by recordSetKey
+	recordSets map[string]*clouddns.ResourceRecordSet
 }
 
-// NewAPI configures and returns a valid API object
-func NewAPI() *API {
-	var ret *API
-	return ret
+// NewAPI configures and returns a valid API object using the default
+// google application credentials
+func NewAPI(ctx context.Context, config map[string]string) (*API, error) {
+	service, err := clouddns.NewService(ctx)
+	if err != nil {
+		return nil, dns.NewError(provider, "connect", dns.AuthError, err)
+	}
+	return NewAPIWithService(service, config)
 }
 
-// GetRegistry represents the external-dns TXT registry in clouddns
-func (*API) GetRegistry() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
-	return ret
+// NewAPIWithService returns an API object that talks to clouddns through the given service
+func NewAPIWithService(service *clouddns.Service, config map[string]string) (*API, error) {
+	api := API{
+		Service:     service,
+		Project:     config[ProjectKey],
+		ManagedZone: config[ManagedZoneKey],
+	}
+	if api.Project == "" || api.ManagedZone == "" {
+		return nil, fmt.Errorf("The clouddns provider requires both %s and %s to be set", ProjectKey, ManagedZoneKey)
+	}
+	return &api, nil
+}
+
+// GetRecords returns every record set in the clouddns managed zone
+func (a *API) GetRecords(ctx context.Context) ([]dns.Record, error) {
+	recordSets, err := a.getRecordSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.recordSets = make(map[string]*clouddns.ResourceRecordSet)
+	var ret []dns.Record
+	for _, item := range recordSets {
+		a.recordSets[recordSetKey(item.Name, item.Type)] = item
+		ret = append(ret, dns.Record{
+			Name:    item.Name,
+			Targets: item.Rrdatas,
+			TTL:     item.Ttl,
+			Type:    item.Type,
+		})
+	}
+	return ret, nil
+}
+
+// SetRegistry replaces the registry value of the TXT record set with the given
+// name in clouddns, creating the record set if needed. Any other values in the
+// record set are kept.
+func (a *API) SetRegistry(ctx context.Context, name, value string) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRegistryAction, Name: name, Value: value},
+	})
+}
+
+// DeleteRegistry removes the registry value from the TXT record set with the
+// given name in clouddns. The record set is deleted if nothing else is left in it.
+func (a *API) DeleteRegistry(ctx context.Context, name string) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRegistryAction, Name: name},
+	})
+}
+
+// SetRecord replaces the record set with the same name and type in clouddns,
+// creating it if needed
+func (a *API) SetRecord(ctx context.Context, record dns.Record) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRecordAction, Record: record},
+	})
+}
+
+// DeleteRecord deletes the record set with the same name and type from clouddns
+func (a *API) DeleteRecord(ctx context.Context, record dns.Record) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRecordAction, Record: record},
+	})
+}
+
+// ApplyBatch applies every change in a single clouddns Change so either all
+// of them or none of them are made. The record sets the changes replace are
+// taken from the listing of the last GetRecords call, which is kept up to date
+// with the changes applied since, rather than requested one by one.
+func (a *API) ApplyBatch(ctx context.Context, changes []dns.Change) error {
+	var batch clouddns.Change
+	for _, change := range changes {
+		err := a.addToChange(ctx, &batch, change)
+		if err != nil {
+			return err
+		}
+	}
+	if len(batch.Additions)+len(batch.Deletions) == 0 {
+		return nil
+	}
+	_, err := a.Service.Changes.Create(a.Project, a.ManagedZone, &batch).Context(ctx).Do()
+	if err != nil {
+		return newError(fmt.Sprintf("apply %d changes", len(changes)), err)
+	}
+	if a.recordSets != nil {
+		for _, item := range batch.Deletions {
+			delete(a.recordSets, recordSetKey(item.Name, item.Type))
+		}
+		for _, item := range batch.Additions {
+			a.recordSets[recordSetKey(item.Name, item.Type)] = item
+		}
+	}
+	return nil
+}
+
+func (a *API) addToChange(ctx context.Context, batch *clouddns.Change, change dns.Change) error {
+	switch change.Action {
+	case dns.SetRecordAction, dns.DeleteRecordAction:
+		{
+			existing, err := a.getRecordSet(ctx, change.Record.Name, change.Record.Type)
+			if err != nil {
+				return err
+			}
+			batch.Deletions = append(batch.Deletions, existing...)
+			if change.Action == dns.SetRecordAction {
+				batch.Additions = append(batch.Additions, &clouddns.ResourceRecordSet{
+					Name:    fqdn(change.Record.Name),
+					Type:    change.Record.Type,
+					Ttl:     change.Record.TTLOrDefault(),
+					Rrdatas: rrdatas(change.Record),
+				})
+			}
+			return nil
+		}
+	case dns.SetRegistryAction, dns.DeleteRegistryAction:
+		{
+			existing, err := a.getRecordSet(ctx, change.Name, "TXT")
+			if err != nil {
+				return err
+			}
+			batch.Deletions = append(batch.Deletions, existing...)
+			replacement := clouddns.ResourceRecordSet{
+				Name: fqdn(change.Name),
+				Type: "TXT",
+				Ttl:  dns.RegistryTTL,
+			}
+			if change.Action == dns.SetRegistryAction {
+				content, err := dns.RegistryContent(change.Value, a.RegistryKey)
+				if err != nil {
+					return err
+				}
+				replacement.Rrdatas = append(replacement.Rrdatas, content)
+			}
+			for _, item := range existing {
+				replacement.Ttl = item.Ttl
+				for _, data := range item.Rrdatas {
+					if !dns.IsRegistryValue(data, a.RegistryKey) {
+						replacement.Rrdatas = append(replacement.Rrdatas, data)
+					}
+				}
+			}
+			if len(replacement.Rrdatas) > 0 {
+				batch.Additions = append(batch.Additions, &replacement)
+			}
+			return nil
+		}
+	default:
+		{
+			return fmt.Errorf("Unknown change action: %s", change.Action)
+		}
+	}
+}
+
+// getRecordSet returns the record set with the given name and type, if there
+// is one. It is only requested from clouddns when GetRecords has not listed the
+// zone yet.
+func (a *API) getRecordSet(ctx context.Context, name, recordType string) ([]*clouddns.ResourceRecordSet, error) {
+	if a.recordSets != nil {
+		if item, exists := a.recordSets[recordSetKey(name, recordType)]; exists {
+			return []*clouddns.ResourceRecordSet{item}, nil
+		}
+		return nil, nil
+	}
+	resp, err := a.Service.ResourceRecordSets.List(a.Project, a.ManagedZone).Name(fqdn(name)).Type(recordType).Context(ctx).Do()
+	if err != nil {
+		return nil, newError(fmt.Sprintf("look up %s record %s", recordType, name), err)
+	}
+	return resp.Rrsets, nil
 }
 
-// GetRecords represents the external-dns records in clouddns
-func (*API) GetRecords() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
+// recordSetKey identifies a record set by its name and type
+func recordSetKey(name, recordType string) string {
+	return strings.ToLower(fqdn(name)) + " " + recordType
+}
+
+func (a *API) getRecordSets(ctx context.Context) ([]*clouddns.ResourceRecordSet, error) {
+	var ret []*clouddns.ResourceRecordSet
+	err := a.Service.ResourceRecordSets.List(a.Project, a.ManagedZone).Pages(ctx, func(page *clouddns.ResourceRecordSetsListResponse) error {
+		ret = append(ret, page.Rrsets...)
+		return nil
+	})
+	if err != nil {
+		return nil, newError("list records", err)
+	}
+	return ret, nil
+}
+
+// newError classifies an error returned by the google api client
+func newError(op string, err error) error {
+	kind := dns.UnknownError
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		kind = dns.KindFromStatus(apiErr.Code)
+	}
+	return dns.NewError(provider, op, kind, err)
+}
+
+// rrdatas returns the targets of the record the way clouddns expects them,
+// CNAME targets have to be absolute names
+func rrdatas(record dns.Record) []string {
+	if record.Type != "CNAME" {
+		return record.Targets
+	}
+	var ret []string
+	for _, target := range record.Targets {
+		ret = append(ret, fqdn(target))
+	}
 	return ret
 }
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,329 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clouddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+	clouddns "google.golang.org/api/dns/v1"
+	"google.golang.org/api/option"
+)
+
+const zonePath = "/dns/v1/projects/my-project/managedZones/my-zone"
+
+// fakeCloudDNS is a stand-in for the rrsets and changes endpoints of the cloud
+// dns REST api. Record sets are listed pageSize at a time using nextPageToken
+// and every request fails with status when it is set.
+type fakeCloudDNS struct {
+	mu       sync.Mutex
+	rrsets   []*clouddns.ResourceRecordSet
+	changes  []*clouddns.Change
+	pageSize int
+	lists    int // lists counts the rrsets list requests
+	status   int
+}
+
+func (f *fakeCloudDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprintf(w, `{"error":{"code":%d,"message":"failed"}}`, f.status)
+		return
+	}
+	switch {
+	case r.URL.Path == zonePath+"/rrsets" && r.Method == http.MethodGet:
+		{
+			f.lists++
+			f.list(w, r)
+		}
+	case r.URL.Path == zonePath+"/changes" && r.Method == http.MethodPost:
+		{
+			var change clouddns.Change
+			json.NewDecoder(r.Body).Decode(&change)
+			f.apply(&change)
+			f.changes = append(f.changes, &change)
+			json.NewEncoder(w).Encode(&change)
+		}
+	default:
+		{
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"not found"}}`)
+		}
+	}
+}
+
+func (f *fakeCloudDNS) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var matching []*clouddns.ResourceRecordSet
+	for _, rrset := range f.rrsets {
+		if name := query.Get("name"); name != "" && name != rrset.Name {
+			continue
+		}
+		if recordType := query.Get("type"); recordType != "" && recordType != rrset.Type {
+			continue
+		}
+		matching = append(matching, rrset)
+	}
+	start, _ := strconv.Atoi(query.Get("pageToken"))
+	resp := clouddns.ResourceRecordSetsListResponse{Rrsets: matching[start:]}
+	if f.pageSize > 0 && len(matching)-start > f.pageSize {
+		resp.Rrsets = matching[start : start+f.pageSize]
+		resp.NextPageToken = strconv.Itoa(start + f.pageSize)
+	}
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (f *fakeCloudDNS) apply(change *clouddns.Change) {
+	for _, deletion := range change.Deletions {
+		for i, rrset := range f.rrsets {
+			if rrset.Name == deletion.Name && rrset.Type == deletion.Type {
+				f.rrsets = append(f.rrsets[:i], f.rrsets[i+1:]...)
+				break
+			}
+		}
+	}
+	f.rrsets = append(f.rrsets, change.Additions...)
+}
+
+// rrdatas returns the rrdatas of the record set with the given name and type
+func (f *fakeCloudDNS) rrdatas(name, recordType string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rrset := range f.rrsets {
+		if rrset.Name == name && rrset.Type == recordType {
+			return rrset.Rrdatas
+		}
+	}
+	return nil
+}
+
+func newTestAPI(t *testing.T, fake *fakeCloudDNS) (*API, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	service, err := clouddns.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/dns/v1/projects/"),
+		option.WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewService returned %v", err)
+	}
+	api, err := NewAPIWithService(service, map[string]string{
+		ProjectKey:     "my-project",
+		ManagedZoneKey: "my-zone",
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewAPIWithService returned %v", err)
+	}
+	return api, server
+}
+
+func TestNewAPIWithServiceValidatesConfig(t *testing.T) {
+	for _, config := range []map[string]string{
+		nil,
+		{ProjectKey: "my-project"},
+		{ManagedZoneKey: "my-zone"},
+		{ProjectKey: "", ManagedZoneKey: "my-zone"},
+	} {
+		if _, err := NewAPIWithService(&clouddns.Service{}, config); err == nil {
+			t.Errorf("NewAPIWithService accepted config %v", config)
+		}
+	}
+}
+
+func TestGetRecordsReadsEveryPage(t *testing.T) {
+	fake := &fakeCloudDNS{pageSize: 2}
+	for i := 0; i < 5; i++ {
+		fake.rrsets = append(fake.rrsets, &clouddns.ResourceRecordSet{
+			Name:    fmt.Sprintf("host%d.example.com.", i),
+			Type:    "A",
+			Ttl:     300,
+			Rrdatas: []string{fmt.Sprintf("10.0.0.%d", i), fmt.Sprintf("10.0.1.%d", i)},
+		})
+	}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+
+	records, err := api.GetRecords(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	if len(records) != len(fake.rrsets) {
+		t.Fatalf("GetRecords returned %d records, want %d", len(records), len(fake.rrsets))
+	}
+	for i, record := range records {
+		want := fake.rrsets[i]
+		if record.Name != want.Name || record.Type != want.Type || record.TTL != want.Ttl ||
+			strings.Join(record.Targets, ",") != strings.Join(want.Rrdatas, ",") {
+			t.Errorf("record %d is %+v, want %+v", i, record, *want)
+		}
+	}
+}
+
+func TestSetRegistryKeepsOtherValues(t *testing.T) {
+	fake := &fakeCloudDNS{rrsets: []*clouddns.ResourceRecordSet{{
+		Name:    "a.example.com.",
+		Type:    "TXT",
+		Ttl:     600,
+		Rrdatas: []string{`"v=spf1 -all"`, dns.QuoteValue(dns.RegistryValue("old", "service/default/a"))},
+	}}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	value := dns.RegistryValue("new", "service/default/a")
+	if err := api.SetRegistry(ctx, "a.example.com", value); err != nil {
+		t.Fatalf("SetRegistry returned %v", err)
+	}
+	got := fake.rrdatas("a.example.com.", "TXT")
+	want := []string{dns.QuoteValue(value), `"v=spf1 -all"`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("after SetRegistry the rrdatas are %q, want %q", got, want)
+	}
+
+	if err := api.DeleteRegistry(ctx, "a.example.com"); err != nil {
+		t.Fatalf("DeleteRegistry returned %v", err)
+	}
+	got = fake.rrdatas("a.example.com.", "TXT")
+	if len(got) != 1 || got[0] != `"v=spf1 -all"` {
+		t.Errorf("after DeleteRegistry the rrdatas are %q, want only the spf value", got)
+	}
+	if len(fake.changes) != 2 {
+		t.Errorf("%d changes were sent, want 2", len(fake.changes))
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, dns.ErrAuth},
+		{http.StatusForbidden, dns.ErrAuth},
+		{http.StatusNotFound, dns.ErrNotFound},
+		{http.StatusTooManyRequests, dns.ErrRateLimited},
+		{http.StatusServiceUnavailable, dns.ErrTransient},
+	}
+	for _, test := range tests {
+		api, server := newTestAPI(t, &fakeCloudDNS{status: test.status})
+		_, err := api.GetRecords(context.Background())
+		server.Close()
+		if !errors.Is(err, test.want) {
+			t.Errorf("status %d returned %v, want %v", test.status, err, test.want)
+		}
+	}
+}
+
+func TestSetRecordUsesAbsoluteCNAMETargets(t *testing.T) {
+	fake := &fakeCloudDNS{}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	records := []dns.Record{
+		{Name: "www.example.com", Type: "CNAME", Targets: []string{"lb.example.net"}},
+		{Name: "api.example.com", Type: "CNAME", Targets: []string{"lb.example.net."}},
+		{Name: "a.example.com", Type: "A", Targets: []string{"10.0.0.1"}},
+	}
+	for _, record := range records {
+		if err := api.SetRecord(ctx, record); err != nil {
+			t.Fatalf("SetRecord returned %v", err)
+		}
+	}
+	for _, name := range []string{"www.example.com.", "api.example.com."} {
+		if got := fake.rrdatas(name, "CNAME"); len(got) != 1 || got[0] != "lb.example.net." {
+			t.Errorf("%s points to %q, want lb.example.net.", name, got)
+		}
+	}
+	if got := fake.rrdatas("a.example.com.", "A"); len(got) != 1 || got[0] != "10.0.0.1" {
+		t.Errorf("a.example.com. points to %q, want 10.0.0.1", got)
+	}
+}
+
+func TestApplyBatchUsesTheZoneListing(t *testing.T) {
+	fake := &fakeCloudDNS{rrsets: []*clouddns.ResourceRecordSet{
+		{Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.0.1"}},
+		{Name: "www.example.com.", Type: "TXT", Ttl: 600, Rrdatas: []string{`"v=spf1 -all"`}},
+		{Name: "old.example.com.", Type: "CNAME", Ttl: 300, Rrdatas: []string{"lb.example.net."}},
+		{Name: "old.example.com.", Type: "TXT", Ttl: 300, Rrdatas: []string{dns.QuoteValue(dns.RegistryValue("default", "service/default/old"))}},
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+	if _, err := api.GetRecords(ctx); err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+
+	value := dns.RegistryValue("default", "service/default/www")
+	err := api.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRecordAction, Record: dns.Record{Name: "www.example.com", Type: "A", Targets: []string{"10.0.0.2"}}},
+		{Action: dns.SetRegistryAction, Name: "www.example.com", Value: value},
+		{Action: dns.DeleteRecordAction, Record: dns.Record{Name: "old.example.com", Type: "CNAME"}},
+		{Action: dns.DeleteRegistryAction, Name: "old.example.com"},
+		{Action: dns.SetRecordAction, Record: dns.Record{Name: "new.example.com", Type: "A", Targets: []string{"10.0.0.3"}}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch returned %v", err)
+	}
+	if fake.lists != 1 {
+		t.Errorf("%d list requests were made, want only the one of GetRecords", fake.lists)
+	}
+	if len(fake.changes) != 1 {
+		t.Fatalf("%d changes were sent, want 1", len(fake.changes))
+	}
+	tests := []struct {
+		name       string
+		recordType string
+		want       []string
+	}{
+		{"www.example.com.", "A", []string{"10.0.0.2"}},
+		{"www.example.com.", "TXT", []string{dns.QuoteValue(value), `"v=spf1 -all"`}},
+		{"old.example.com.", "CNAME", nil},
+		{"old.example.com.", "TXT", nil},
+		{"new.example.com.", "A", []string{"10.0.0.3"}},
+	}
+	for _, test := range tests {
+		if got := fake.rrdatas(test.name, test.recordType); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s %s is %q, want %q", test.recordType, test.name, got, test.want)
+		}
+	}
+
+	// the listing follows the applied changes, so the next batch replaces the
+	// record set that was just added
+	err = api.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRecordAction, Record: dns.Record{Name: "new.example.com", Type: "A"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch returned %v", err)
+	}
+	if got := fake.rrdatas("new.example.com.", "A"); got != nil {
+		t.Errorf("A new.example.com. is %q after its deletion", got)
+	}
+	if deletions := fake.changes[1].Deletions; len(deletions) != 1 || deletions[0].Rrdatas[0] != "10.0.0.3" {
+		t.Errorf("the second change deleted %+v, want the record set added by the first", deletions)
+	}
+	if fake.lists != 1 {
+		t.Errorf("%d list requests were made, want only the one of GetRecords", fake.lists)
+	}
+}
@@ -11,24 +11,260 @@
 
 package cloudflare
 
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cf "github.com/cloudflare/cloudflare-go"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+const (
+	apiKeyEnv  string = "EDNS_API_KEY"
+	apiUserEnv string = "EDNS_API_USER"
+	provider   string = "cloudflare"
+)
+
+// statusPattern matches the HTTP status cloudflare-go puts in its error messages
+var statusPattern = regexp.MustCompile(`HTTP status (\d+)`)
+
 // API represents a connection to cloudflare
 type API struct {
+	Client      *cf.API
+	RegistryKey []byte
+	Zone        string
+	ZoneID      string
+}
+
+// NewAPI configures and returns a valid API object using the
+// EDNS_API_KEY and EDNS_API_USER environment variables
+func NewAPI(ctx context.Context, zone string) (*API, error) {
+	client, err := cf.New(os.Getenv(apiKeyEnv), os.Getenv(apiUserEnv))
+	if err != nil {
+		return nil, dns.NewError(provider, fmt.Sprintf("connect (are %s and %s set?)", apiKeyEnv, apiUserEnv), dns.AuthError, err)
+	}
+	return NewAPIWithClient(ctx, client, zone)
+}
+
+// NewAPIWithClient returns an API object that talks to cloudflare through the given client
+func NewAPIWithClient(ctx context.Context, client *cf.API, zone string) (*API, error) {
+	op := "find zone " + zone
+	zones, err := client.ListZonesContext(ctx, cf.WithZoneFilter(zone))
+	if err != nil {
+		return nil, newError(op, err)
+	}
+	api := API{
+		Client: client,
+		Zone:   zone,
+	}
+	for _, item := range zones.Result {
+		if item.Name == zone {
+			api.ZoneID = item.ID
+			return &api, nil
+		}
+	}
+	return nil, dns.NewError(provider, op, dns.NotFoundError, dns.ErrNotFound)
+}
+
+// GetRecords returns every record set in the cloudflare zone. Cloudflare
+// records sharing a name and type are returned as a single record set.
+func (a *API) GetRecords(ctx context.Context) ([]dns.Record, error) {
+	recs, err := a.lookup(ctx, cf.DNSRecord{})
+	if err != nil {
+		return nil, err
+	}
+	var ret []dns.Record
+	var index = make(map[string]int)
+	for _, item := range recs {
+		key := item.Type + " " + item.Name
+		if i, exists := index[key]; exists {
+			ret[i].Targets = append(ret[i].Targets, item.Content)
+			continue
+		}
+		index[key] = len(ret)
+		ret = append(ret, dns.Record{
+			Metadata: map[string]string{
+				dns.ProxiedMetadata: strconv.FormatBool(item.Proxied),
+			},
+			Name:    item.Name,
+			Targets: []string{item.Content},
+			TTL:     int64(item.TTL),
+			Type:    item.Type,
+		})
+	}
+	return ret, nil
+}
+
+// SetRegistry creates or updates the TXT registry record with the given name in cloudflare
+func (a *API) SetRegistry(ctx context.Context, name, value string) error {
+	recs, err := a.lookup(ctx, cf.DNSRecord{
+		Name: name,
+		Type: "TXT",
+	})
+	if err != nil {
+		return err
+	}
+	content, err := dns.RegistryContent(value, a.RegistryKey)
+	if err != nil {
+		return err
+	}
+	record := cf.DNSRecord{
+		Name:    name,
+		Type:    "TXT",
+		Content: content,
+		TTL:     dns.RegistryTTL,
+	}
+	for _, item := range recs {
+		if !dns.IsRegistryValue(item.Content, a.RegistryKey) {
+			continue
+		}
+		return a.update(ctx, item.ID, record)
+	}
+	return a.create(ctx, record)
+}
+
+// SetRecord creates a cloudflare record for every target of the given record
+// and deletes the records of the same name and type pointing anywhere else
+func (a *API) SetRecord(ctx context.Context, record dns.Record) error {
+	recs, err := a.lookup(ctx, cf.DNSRecord{
+		Name: record.Name,
+		Type: record.Type,
+	})
+	if err != nil {
+		return err
+	}
+	var existing = make(map[string]bool)
+	for _, item := range recs {
+		existing[item.Content] = true
+	}
+	var wanted = make(map[string]bool)
+	for _, target := range record.Targets {
+		wanted[target] = true
+		if existing[target] {
+			continue
+		}
+		err = a.create(ctx, cf.DNSRecord{
+			Name:    record.Name,
+			Type:    record.Type,
+			Content: target,
+			TTL:     int(record.TTLOrDefault()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, item := range recs {
+		if wanted[item.Content] {
+			continue
+		}
+		if err = a.remove(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRecord deletes every cloudflare record with the same name and type
+func (a *API) DeleteRecord(ctx context.Context, record dns.Record) error {
+	recs, err := a.lookup(ctx, cf.DNSRecord{
+		Name: record.Name,
+		Type: record.Type,
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range recs {
+		if err = a.remove(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRegistry deletes the TXT registry record with the given name from cloudflare
+func (a *API) DeleteRegistry(ctx context.Context, name string) error {
+	recs, err := a.lookup(ctx, cf.DNSRecord{
+		Name: name,
+		Type: "TXT",
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range recs {
+		if !dns.IsRegistryValue(item.Content, a.RegistryKey) {
+			continue
+		}
+		if err = a.remove(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the records matching the filter. DNSRecords keeps requesting
+// pages until result_info reports the last one. cloudflare-go does not pass
+// the context on to its requests so it is checked before every call.
+func (a *API) lookup(ctx context.Context, filter cf.DNSRecord) ([]cf.DNSRecord, error) {
+	op := "list records"
+	if filter.Name != "" {
+		op = fmt.Sprintf("look up %s record %s", filter.Type, filter.Name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, dns.NewError(provider, op, dns.UnknownError, err)
+	}
+	recs, err := a.Client.DNSRecords(a.ZoneID, filter)
+	if err != nil {
+		return nil, newError(op, err)
+	}
+	return recs, nil
+}
+
+func (a *API) create(ctx context.Context, record cf.DNSRecord) error {
+	op := fmt.Sprintf("create %s record %s", record.Type, record.Name)
+	if err := ctx.Err(); err != nil {
+		return dns.NewError(provider, op, dns.UnknownError, err)
+	}
+	if _, err := a.Client.CreateDNSRecord(a.ZoneID, record); err != nil {
+		return newError(op, err)
+	}
+	return nil
 }
 
-// NewAPI configures and returns a valid API object
-func NewAPI() *API {
-	var ret *API
-	return ret
+func (a *API) update(ctx context.Context, id string, record cf.DNSRecord) error {
+	op := fmt.Sprintf("update %s record %s", record.Type, record.Name)
+	if err := ctx.Err(); err != nil {
+		return dns.NewError(provider, op, dns.UnknownError, err)
+	}
+	if err := a.Client.UpdateDNSRecord(a.ZoneID, id, record); err != nil {
+		return newError(op, err)
+	}
+	return nil
 }
 
-// GetRegistry represents the external-dns TXT registry in cloudflare
-func (*API) GetRegistry() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
-	return ret
+func (a *API) remove(ctx context.Context, record cf.DNSRecord) error {
+	op := fmt.Sprintf("delete %s record %s", record.Type, record.Name)
+	if err := ctx.Err(); err != nil {
+		return dns.NewError(provider, op, dns.UnknownError, err)
+	}
+	if err := a.Client.DeleteDNSRecord(a.ZoneID, record.ID); err != nil {
+		return newError(op, err)
+	}
+	return nil
 }
 
-// GetRecords represents the external-dns records in cloudflare
-func (*API) GetRecords() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
-	return ret
+// newError classifies an error returned by cloudflare-go, which only reports
+// the HTTP status in the error message
+func newError(op string, err error) error {
+	kind := dns.UnknownError
+	if match := statusPattern.FindStringSubmatch(err.Error()); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		kind = dns.KindFromStatus(status)
+	} else if strings.Contains(err.Error(), "rate limit") {
+		kind = dns.RateLimitedError
+	}
+	return dns.NewError(provider, op, kind, err)
 }
@@ -0,0 +1,320 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	cf "github.com/cloudflare/cloudflare-go"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+const testZoneID = "zone-1"
+
+// fakeCloudflare is a stand-in for the parts of the cloudflare API the
+// provider uses. Records are listed pageSize at a time and every request fails
+// with status when it is set.
+type fakeCloudflare struct {
+	mu       sync.Mutex
+	records  []cf.DNSRecord
+	nextID   int
+	pageSize int
+	status   int
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, `{"success":false}`)
+		return
+	}
+	prefix := "/zones/" + testZoneID + "/dns_records"
+	switch {
+	case r.URL.Path == "/zones":
+		{
+			f.write(w, []cf.Zone{{ID: "zone-0", Name: "other.com"}, {ID: testZoneID, Name: "example.com"}}, cf.ResultInfo{Page: 1, TotalPages: 1})
+		}
+	case r.URL.Path == prefix && r.Method == http.MethodGet:
+		{
+			f.list(w, r)
+		}
+	case r.URL.Path == prefix && r.Method == http.MethodPost:
+		{
+			var record cf.DNSRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			f.nextID++
+			record.ID = "rec-" + strconv.Itoa(f.nextID)
+			f.records = append(f.records, record)
+			f.write(w, record, cf.ResultInfo{})
+		}
+	case strings.HasPrefix(r.URL.Path, prefix+"/"):
+		{
+			id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+			for i, record := range f.records {
+				if record.ID != id {
+					continue
+				}
+				switch r.Method {
+				case http.MethodPatch:
+					{
+						json.NewDecoder(r.Body).Decode(&f.records[i])
+						f.records[i].ID = id
+					}
+				case http.MethodDelete:
+					{
+						f.records = append(f.records[:i], f.records[i+1:]...)
+					}
+				}
+				f.write(w, record, cf.ResultInfo{})
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	default:
+		{
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func (f *fakeCloudflare) list(w http.ResponseWriter, r *http.Request) {
+	var matching []cf.DNSRecord
+	for _, record := range f.records {
+		if name := r.URL.Query().Get("name"); name != "" && name != record.Name {
+			continue
+		}
+		if recordType := r.URL.Query().Get("type"); recordType != "" && recordType != record.Type {
+			continue
+		}
+		matching = append(matching, record)
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize := f.pageSize
+	if pageSize == 0 {
+		pageSize = 50
+	}
+	totalPages := (len(matching) + pageSize - 1) / pageSize
+	start, end := (page-1)*pageSize, page*pageSize
+	if start > len(matching) {
+		start = len(matching)
+	}
+	if end > len(matching) {
+		end = len(matching)
+	}
+	f.write(w, matching[start:end], cf.ResultInfo{Page: page, PerPage: pageSize, TotalPages: totalPages, Total: len(matching)})
+}
+
+func (f *fakeCloudflare) write(w http.ResponseWriter, result interface{}, info cf.ResultInfo) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"result":      result,
+		"result_info": info,
+	})
+}
+
+// contents returns the content of the records with the given name and type
+func (f *fakeCloudflare) contents(name, recordType string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ret []string
+	for _, record := range f.records {
+		if record.Name == name && record.Type == recordType {
+			ret = append(ret, record.Content)
+		}
+	}
+	return ret
+}
+
+// newTestClient returns a client talking to an httptest server backed by fake,
+// without retries so error statuses come back straight away
+func newTestClient(t *testing.T, fake *fakeCloudflare) (*cf.API, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	client, err := cf.New("key", "user@example.com", cf.UsingRetryPolicy(0, 0, 0), cf.UsingRateLimit(1000))
+	if err != nil {
+		server.Close()
+		t.Fatalf("cf.New returned %v", err)
+	}
+	client.BaseURL = server.URL
+	return client, server
+}
+
+func newTestAPI(t *testing.T, fake *fakeCloudflare) (*API, *httptest.Server) {
+	t.Helper()
+	client, server := newTestClient(t, fake)
+	api, err := NewAPIWithClient(context.Background(), client, "example.com")
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewAPIWithClient returned %v", err)
+	}
+	return api, server
+}
+
+func TestNewAPIWithClientFindsZone(t *testing.T) {
+	fake := &fakeCloudflare{}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	if api.ZoneID != testZoneID {
+		t.Errorf("ZoneID = %q, want %q", api.ZoneID, testZoneID)
+	}
+
+	_, err := NewAPIWithClient(context.Background(), api.Client, "missing.com")
+	if !errors.Is(err, dns.ErrNotFound) {
+		t.Errorf("missing zone returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetRecordsReadsEveryPageAndGroups(t *testing.T) {
+	fake := &fakeCloudflare{pageSize: 2}
+	for i, record := range []cf.DNSRecord{
+		{Name: "a.example.com", Type: "A", Content: "1.1.1.1", TTL: 120, Proxied: true},
+		{Name: "b.example.com", Type: "CNAME", Content: "lb.example.net", TTL: 1},
+		{Name: "a.example.com", Type: "A", Content: "2.2.2.2", TTL: 120, Proxied: true},
+		{Name: "a.example.com", Type: "AAAA", Content: "::1", TTL: 120},
+		{Name: "c.example.com", Type: "TXT", Content: `"heritage=external-dns"`, TTL: 300},
+	} {
+		record.ID = fmt.Sprintf("rec-%d", i)
+		fake.records = append(fake.records, record)
+	}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	records, err := api.GetRecords(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, fmt.Sprintf("%s %s %s", record.Name, record.Type, record.Target()))
+	}
+	want := []string{
+		"a.example.com A 1.1.1.1,2.2.2.2",
+		"b.example.com CNAME lb.example.net",
+		"a.example.com AAAA ::1",
+		"c.example.com TXT \"heritage=external-dns\"",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GetRecords returned\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if records[0].Metadata[dns.ProxiedMetadata] != "true" || records[0].TTL != 120 {
+		t.Errorf("grouped record lost its settings: %+v", records[0])
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, dns.ErrAuth},
+		{http.StatusForbidden, dns.ErrAuth},
+		{http.StatusTooManyRequests, dns.ErrRateLimited},
+		{http.StatusInternalServerError, dns.ErrTransient},
+		{http.StatusServiceUnavailable, dns.ErrTransient},
+	}
+	for _, test := range tests {
+		client, server := newTestClient(t, &fakeCloudflare{status: test.status})
+		_, err := NewAPIWithClient(context.Background(), client, "example.com")
+		server.Close()
+		if !errors.Is(err, test.want) {
+			t.Errorf("status %d returned %v, want %v", test.status, err, test.want)
+		}
+		if !dns.IsTemporary(err) && (test.want == dns.ErrRateLimited || test.want == dns.ErrTransient) {
+			t.Errorf("status %d is not temporary", test.status)
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	api, server := newTestAPI(t, &fakeCloudflare{})
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := api.GetRecords(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetRecords with a canceled context returned %v", err)
+	}
+}
+
+func TestSetAndDeleteRegistry(t *testing.T) {
+	fake := &fakeCloudflare{records: []cf.DNSRecord{
+		{ID: "rec-other", Name: "a.example.com", Type: "TXT", Content: `"v=spf1 -all"`},
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	first := dns.RegistryValue("old", "service/default/a")
+	second := dns.RegistryValue("new", "service/default/a")
+	for _, value := range []string{first, second} {
+		if err := api.SetRegistry(ctx, "a.example.com", value); err != nil {
+			t.Fatalf("SetRegistry returned %v", err)
+		}
+	}
+	got := fake.contents("a.example.com", "TXT")
+	want := []string{`"v=spf1 -all"`, dns.QuoteValue(second)}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("after SetRegistry the TXT records are %q, want %q", got, want)
+	}
+
+	if err := api.DeleteRegistry(ctx, "a.example.com"); err != nil {
+		t.Fatalf("DeleteRegistry returned %v", err)
+	}
+	got = fake.contents("a.example.com", "TXT")
+	if len(got) != 1 || got[0] != `"v=spf1 -all"` {
+		t.Errorf("after DeleteRegistry the TXT records are %q, want only the spf record", got)
+	}
+}
+
+func TestEncryptedRegistry(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	old, err := dns.RegistryContent(dns.RegistryValue("old", "service/default/a"), key)
+	if err != nil {
+		t.Fatalf("RegistryContent returned %v", err)
+	}
+	fake := &fakeCloudflare{records: []cf.DNSRecord{
+		{ID: "rec-old", Name: "a.example.com", Type: "TXT", Content: old},
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	api.RegistryKey = key
+	ctx := context.Background()
+
+	value := dns.RegistryValue("new", "service/default/a")
+	if err := api.SetRegistry(ctx, "a.example.com", value); err != nil {
+		t.Fatalf("SetRegistry returned %v", err)
+	}
+	got := fake.contents("a.example.com", "TXT")
+	if len(got) != 1 {
+		t.Fatalf("after SetRegistry the TXT records are %q, want a single one", got)
+	}
+	if plain, err := dns.DecryptValue(got[0], key); err != nil || plain != value {
+		t.Errorf("SetRegistry wrote %s which decrypts to %q (%v), want %q", got[0], plain, err, value)
+	}
+
+	if err := api.DeleteRegistry(ctx, "a.example.com"); err != nil {
+		t.Fatalf("DeleteRegistry returned %v", err)
+	}
+	if got = fake.contents("a.example.com", "TXT"); len(got) != 0 {
+		t.Errorf("after DeleteRegistry the TXT records are %q, want none", got)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// AESKeySize is the size of the key external-dns encrypts TXT registry values with
+const AESKeySize = 32
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ParseAESKey returns the key given to external-dns with --txt-encrypt-aes-key.
+// The key is accepted as is or base64 encoded.
+func ParseAESKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if len(key) == AESKeySize {
+		return []byte(key), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err == nil && len(decoded) == AESKeySize {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("The TXT registry encryption key must be %d bytes long, or base64 encoded %d bytes", AESKeySize, AESKeySize)
+}
+
+// DecryptValue decrypts a TXT registry value encrypted by external-dns. The
+// value is the base64 encoded AES-GCM nonce followed by the sealed data, which
+// newer versions of external-dns gzip before encrypting. The content may be
+// quoted, or split into several TXT strings when it is long.
+func DecryptValue(content string, key []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(unquoteTXT(content))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode the encrypted TXT registry value: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) <= gcm.NonceSize() {
+		return "", fmt.Errorf("The encrypted TXT registry value is too short: %s", content)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("Could not decrypt the TXT registry value: %v", err)
+	}
+	if !bytes.HasPrefix(plain, gzipMagic) {
+		return string(plain), nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return "", fmt.Errorf("Could not decompress the TXT registry value: %v", err)
+	}
+	defer reader.Close()
+	plain, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("Could not decompress the TXT registry value: %v", err)
+	}
+	return string(plain), nil
+}
+
+// EncryptValue encrypts a TXT registry value the way external-dns does, the
+// result is the base64 encoded random AES-GCM nonce followed by the sealed value
+func EncryptValue(value string, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("Could not generate a nonce for the TXT registry value: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// RegistryContent returns the TXT record content holding the registry value,
+// which is encrypted first when a key is given
+func RegistryContent(value string, key []byte) (string, error) {
+	if len(key) == 0 {
+		return QuoteValue(value), nil
+	}
+	encrypted, err := EncryptValue(value, key)
+	if err != nil {
+		return "", err
+	}
+	return QuoteValue(encrypted), nil
+}
+
+// parseRegistryContent decrypts the TXT record content when a key is given
+// and parses it. Content that can not be decrypted is parsed as plain text,
+// as external-dns does.
+func parseRegistryContent(content string, key []byte) (map[string]string, []string, error) {
+	if len(key) > 0 {
+		if plain, err := DecryptValue(content, key); err == nil {
+			return ParseRegistryValue(plain)
+		}
+	}
+	return ParseRegistryValue(content)
+}
@@ -0,0 +1,141 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncryptValueRoundTrip(t *testing.T) {
+	value := RegistryValue("default", "ingress/default/web")
+	content, err := RegistryContent(value, testKey)
+	if err != nil {
+		t.Fatalf("RegistryContent returned %v", err)
+	}
+	if content == QuoteValue(value) {
+		t.Fatalf("RegistryContent did not encrypt %s", value)
+	}
+	plain, err := DecryptValue(content, testKey)
+	if err != nil || plain != value {
+		t.Errorf("DecryptValue(%s) = %q, %v, want %q", content, plain, err, value)
+	}
+	if !IsRegistryValue(content, testKey) {
+		t.Errorf("IsRegistryValue does not recognize the encrypted value with the key")
+	}
+	if IsRegistryValue(content, nil) {
+		t.Errorf("IsRegistryValue recognizes the encrypted value without the key")
+	}
+
+	if content, _ = RegistryContent(value, nil); content != QuoteValue(value) {
+		t.Errorf("RegistryContent without a key = %s, want %s", content, QuoteValue(value))
+	}
+}
+
+// seal encrypts the data with testKey the way external-dns does, gzipping it
+// first when compress is set
+func seal(t *testing.T, data string, compress bool) string {
+	t.Helper()
+	plain := []byte(data)
+	if compress {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write(plain)
+		w.Close()
+		plain = b.Bytes()
+	}
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil))
+}
+
+// splitTXT quotes the content as TXT strings of at most size characters, the
+// way long values are split into several strings
+func splitTXT(content string, size int) string {
+	var parts []string
+	for len(content) > size {
+		parts = append(parts, QuoteValue(content[:size]))
+		content = content[size:]
+	}
+	return strings.Join(append(parts, QuoteValue(content)), " ")
+}
+
+func TestDecryptValue(t *testing.T) {
+	value := RegistryValue("default", "ingress/default/web")
+	tests := []struct {
+		name    string
+		content string
+		key     []byte
+		want    string
+		fails   bool
+	}{
+		{name: "plain", content: seal(t, value, false), key: testKey, want: value},
+		{name: "quoted", content: QuoteValue(seal(t, value, false)), key: testKey, want: value},
+		{name: "gzip", content: seal(t, value, true), key: testKey, want: value},
+		{name: "split", content: splitTXT(seal(t, value, true), 16), key: testKey, want: value},
+		{name: "wrong key", content: seal(t, value, false), key: []byte("abcdef0123456789abcdef0123456789"), fails: true},
+		{name: "not base64", content: QuoteValue(value), key: testKey, fails: true},
+		{name: "too short", content: base64.StdEncoding.EncodeToString([]byte("short")), key: testKey, fails: true},
+	}
+	for _, test := range tests {
+		got, err := DecryptValue(test.content, test.key)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: DecryptValue returned %q and no error", test.name, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: DecryptValue = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestParseRegistryDecrypts(t *testing.T) {
+	records := []Record{
+		{Name: "plain.example.com", Type: "TXT", Targets: []string{QuoteValue(RegistryValue("default", "service/default/a"))}},
+		{Name: "gzip.example.com", Type: "TXT", Targets: []string{QuoteValue(seal(t, RegistryValue("default", "service/default/b"), true))}},
+	}
+	registry := ParseRegistry(records, testKey)
+	if len(registry) != 2 || registry["gzip.example.com"].Resource != "service/default/b" || registry["plain.example.com"].Owner != "default" {
+		t.Errorf("ParseRegistry with a key returned %+v", registry)
+	}
+	if registry = ParseRegistry(records, nil); len(registry) != 1 {
+		t.Errorf("ParseRegistry without a key returned %+v, want only the plain value", registry)
+	}
+}
+
+func TestParseAESKey(t *testing.T) {
+	if key, err := ParseAESKey(string(testKey) + "\n"); err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("ParseAESKey of the raw key = %q, %v", key, err)
+	}
+	if key, err := ParseAESKey(base64.StdEncoding.EncodeToString(testKey)); err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("ParseAESKey of the base64 key = %q, %v", key, err)
+	}
+	if _, err := ParseAESKey("short"); err == nil {
+		t.Errorf("ParseAESKey accepted a short key")
+	}
+}
@@ -12,113 +12,324 @@
 package dns
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
 )
 
+const (
+	// RegistryTTL is the TTL external-dns uses for TXT registry records
+	RegistryTTL = 300
+	// RecordTTL is the TTL used for records created by ednsctl
+	RecordTTL = 300
+)
+
+// Labels of the TXT registry values written by external-dns
+const (
+	HeritageLabel = "heritage"
+	OwnerLabel    = "external-dns/owner"
+	ResourceLabel = "external-dns/resource"
+)
+
+// RecordTypes are the types of the records managed by external-dns. ALIAS is
+// used by providers with a native alias record type, route53 alias records are
+// A or AAAA records with AliasMetadata set.
+var RecordTypes = []string{"A", "AAAA", "CNAME", "ALIAS"}
+
+// Metadata keys set by the providers on the records they return
+const (
+	// AliasMetadata is "true" for provider specific alias records e.g. route53 alias targets
+	AliasMetadata = "alias"
+	// ProxiedMetadata is "true" for cloudflare records served through the cloudflare proxy
+	ProxiedMetadata = "proxied"
+	// SetIdentifierMetadata holds the route53 set identifier of weighted, latency or failover records
+	SetIdentifierMetadata = "set-identifier"
+)
+
 // RegistryRecord represents a single TXT registry record
 type RegistryRecord struct {
-	Heritage string
-	Name     string
-	Owner    string
-	Prefix   string
-	Resource string
+	Format     RegistryFormat // Format and RecordType are set by NameMapper.Lookup
+	Heritage   string
+	Labels     map[string]string // Labels holds every label of the value, unknown ones included
+	Name       string
+	Owner      string
+	Prefix     string
+	Problems   []string // Problems describes why the value is malformed
+	RecordType string
+	Resource   string
 	// RegisteredRecord Record
 }
 
-// Record represents an A record in the zone
+// SplitResource returns the kind, namespace and name held in the
+// external-dns/resource label of the registry record
+func (r RegistryRecord) SplitResource() (kind, namespace, name string) {
+	parts := strings.SplitN(r.Resource, "/", 3)
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], parts[2]
+	case 2:
+		return parts[0], "", parts[1]
+	default:
+		return "", "", r.Resource
+	}
+}
+
+// Value returns the content of the registry record with every one of its
+// labels. The heritage, owner and resource labels come first and the others
+// follow sorted by key, labels that were not set are left out.
+func (r RegistryRecord) Value() string {
+	if r.Labels == nil {
+		return RegistryValue(r.Owner, r.Resource)
+	}
+	var keys []string
+	for key := range r.Labels {
+		if key != HeritageLabel && key != OwnerLabel && key != ResourceLabel {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{HeritageLabel, OwnerLabel, ResourceLabel}, keys...)
+	var items []string
+	for _, key := range keys {
+		if value, exists := r.Labels[key]; exists {
+			items = append(items, key+"="+value)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// WithOwner returns a copy of the registry record owned by owner. Every other
+// label is kept as it is.
+func (r RegistryRecord) WithOwner(owner string) RegistryRecord {
+	labels := make(map[string]string)
+	for key, value := range r.Labels {
+		labels[key] = value
+	}
+	if r.Labels == nil {
+		labels[HeritageLabel] = "external-dns"
+		labels[ResourceLabel] = r.Resource
+	}
+	labels[OwnerLabel] = owner
+	r.Labels = labels
+	r.Owner = owner
+	return r
+}
+
+// Record represents a record set in the zone, every record sharing a name and type
 type Record struct {
-	Name       string
-	Registered bool
-	Target     string
-	Type       string
+	Metadata map[string]string // Metadata holds provider specific details, see the *Metadata keys
+	Name     string
+	Targets  []string
+	TTL      int64
+	Type     string
 }
 
-// API abstracts the functions that must be present in a DNS Provider
-type API interface {
-	GetRegistry() map[string]map[string]string
-	GetRecords() map[string]map[string]string
+// Alias reports whether the record is a provider specific alias record
+func (r Record) Alias() bool {
+	return r.Metadata[AliasMetadata] == "true"
 }
 
-// ParseRegistry takes registry data from a provider and returns
-// a map of RegistryRecords
-func ParseRegistry(api API) map[string]RegistryRecord {
-	ret := make(map[string]RegistryRecord)
-	rawRegistry := api.GetRegistry()
-	for hostname, dataMap := range rawRegistry {
-		name := removeTrailingDot(hostname)
-		ret[name] = createRegistryRecordFromMap(dataMap)
+// DisplayType returns the record type shown in reports e.g. "CNAME" or "A (alias)"
+func (r Record) DisplayType() string {
+	if r.Alias() && r.Type != "ALIAS" {
+		return r.Type + " (alias)"
 	}
-	return ret
+	return r.Type
 }
 
-// ParseRecords takes dns data from a provider and returns
-// a map of Records
-func ParseRecords(api API) map[string]Record {
-	ret := make(map[string]Record)
-	rawRecords := api.GetRecords()
-	for hostname, dataMap := range rawRecords {
-		name := removeTrailingDot(hostname)
-		ret[name] = createRecordFromMap(dataMap)
+// TTLOrDefault returns the TTL of the record or RecordTTL if it has none
+func (r Record) TTLOrDefault() int64 {
+	if r.TTL > 0 {
+		return r.TTL
 	}
-	return ret
+	return RecordTTL
 }
 
-func createRegistryRecordFromMap(regMap map[string]string) RegistryRecord {
-	var ret RegistryRecord
-	for key, value := range regMap {
-		switch strings.ToLower(key) {
-		case "heritage":
-			{
-				ret.Heritage = value
-			}
-		case "name":
-			{
-				ret.Name = removeTrailingDot(value)
-			}
-		case "owner":
-			{
-				ret.Owner = value
-			}
-		case "prefix":
-			{
-				ret.Prefix = value
-			}
-		case "resource":
-			{
-				ret.Resource = value
+// Target returns the targets of the record separated by commas
+func (r Record) Target() string {
+	return strings.Join(r.Targets, ",")
+}
+
+// API abstracts the functions that must be present in a DNS Provider.
+// Every method returns an *Error when the provider API call fails.
+type API interface {
+	// GetRecords returns every record set in the zone, TXT registry records included
+	GetRecords(ctx context.Context) ([]Record, error)
+	RegistryWriter
+	RecordWriter
+}
+
+// RegistryWriter creates and deletes TXT registry records
+type RegistryWriter interface {
+	// SetRegistry creates the TXT registry record with the given name or
+	// replaces its registry value if it already exists
+	SetRegistry(ctx context.Context, name, value string) error
+	// DeleteRegistry removes the registry value from the TXT record with the
+	// given name, keeping any other values of the record
+	DeleteRegistry(ctx context.Context, name string) error
+}
+
+// RecordWriter creates and deletes the records owned by external-dns
+type RecordWriter interface {
+	// SetRecord creates the record or replaces the targets of an existing
+	// record with the same name and type
+	SetRecord(ctx context.Context, record Record) error
+	// DeleteRecord removes every record with the same name and type
+	DeleteRecord(ctx context.Context, record Record) error
+}
+
+// ParseRegistry takes the records returned by a provider and returns a map of
+// RegistryRecords indexed by name. The first well formed registry value of a
+// TXT record is used, or the first malformed one if there is none. Values
+// encrypted by external-dns are decrypted when a key is given.
+func ParseRegistry(records []Record, key []byte) map[string]RegistryRecord {
+	ret := make(map[string]RegistryRecord)
+	for _, record := range records {
+		if record.Type != "TXT" {
+			continue
+		}
+		for _, target := range record.Targets {
+			labels, problems, err := parseRegistryContent(target, key)
+			if err != nil {
+				continue
 			}
-		default:
-			{
+			name := removeTrailingDot(record.Name)
+			if existing, exists := ret[name]; exists && len(existing.Problems) == 0 {
 				continue
 			}
+			ret[name] = newRegistryRecord(name, labels, problems)
+			if len(problems) == 0 {
+				break
+			}
 		}
 	}
 	return ret
 }
 
-func createRecordFromMap(regMap map[string]string) Record {
-	var ret Record
-	for key, value := range regMap {
-		switch strings.ToLower(key) {
-		case "name":
+// ParseRecords takes the records returned by a provider and returns the ones of
+// the RecordTypes sorted by name and type, with the trailing dot removed from their names
+func ParseRecords(records []Record) []Record {
+	var ret []Record
+	for _, record := range records {
+		if !IsRecordType(record.Type) {
+			continue
+		}
+		record.Name = removeTrailingDot(record.Name)
+		ret = append(ret, record)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].Type < ret[j].Type
+	})
+	return ret
+}
+
+// IsRecordType reports whether records of the given type are managed by external-dns
+func IsRecordType(recordType string) bool {
+	for _, item := range RecordTypes {
+		if strings.EqualFold(item, recordType) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegistryValue returns the content external-dns writes to a TXT registry
+// record for the given owner and kind/namespace/name resource
+func RegistryValue(owner, resource string) string {
+	return fmt.Sprintf("heritage=external-dns,external-dns/owner=%s,external-dns/resource=%s", owner, resource)
+}
+
+// QuoteValue wraps a TXT record value in the quotes external-dns writes around it
+func QuoteValue(value string) string {
+	return `"` + value + `"`
+}
+
+// IsRegistryValue reports whether the TXT record content is an external-dns
+// registry value. Encrypted values are only recognized when the key is given.
+func IsRegistryValue(content string, key []byte) bool {
+	_, _, err := parseRegistryContent(content, key)
+	return err == nil
+}
+
+// ParseRegistryValue returns every label of the content of an external-dns TXT
+// registry record. Multi-string values are joined and labels that are not
+// key=value pairs, are repeated or are missing are returned as problems. An
+// error is only returned when the content is not a registry value at all.
+func ParseRegistryValue(content string) (map[string]string, []string, error) {
+	value := unquoteTXT(content)
+	if !strings.Contains(value, HeritageLabel+"=") && !strings.Contains(value, "external-dns/") {
+		return nil, nil, fmt.Errorf("This record does not appear to be a TXT registry record. Content: %s", content)
+	}
+	labels := make(map[string]string)
+	var problems []string
+	for _, item := range strings.Split(value, ",") {
+		i := strings.SplitN(item, "=", 2)
+		if len(i) != 2 || i[0] == "" {
+			problems = append(problems, fmt.Sprintf("label %q is not a key=value pair", item))
+			continue
+		}
+		if _, exists := labels[i[0]]; exists {
+			problems = append(problems, fmt.Sprintf("label %s is set more than once", i[0]))
+		}
+		labels[i[0]] = i[1]
+	}
+	if heritage, exists := labels[HeritageLabel]; !exists {
+		problems = append(problems, fmt.Sprintf("label %s is missing", HeritageLabel))
+	} else if heritage != "external-dns" {
+		problems = append(problems, fmt.Sprintf("label %s is %q instead of external-dns", HeritageLabel, heritage))
+	}
+	if labels[OwnerLabel] == "" {
+		problems = append(problems, fmt.Sprintf("label %s is missing", OwnerLabel))
+	}
+	return labels, problems, nil
+}
+
+// unquoteTXT joins the quoted character strings of a TXT record value, so
+// "a=b," "c=d" becomes a=b,c=d. Unquoted content is returned as is.
+func unquoteTXT(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, `"`) {
+		return content
+	}
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, r := range content {
+		switch {
+		case escaped:
 			{
-				ret.Name = removeTrailingDot(value)
+				b.WriteRune(r)
+				escaped = false
 			}
-		case "target":
+		case quoted && r == '\\':
 			{
-				ret.Target = value
+				escaped = true
 			}
-		case "type":
+		case r == '"':
 			{
-				ret.Type = value
+				quoted = !quoted
 			}
-		default:
+		case quoted:
 			{
-				continue
+				b.WriteRune(r)
 			}
 		}
 	}
-	return ret
+	return b.String()
+}
+
+func newRegistryRecord(name string, labels map[string]string, problems []string) RegistryRecord {
+	return RegistryRecord{
+		Heritage: labels[HeritageLabel],
+		Labels:   labels,
+		Name:     name,
+		Owner:    labels[OwnerLabel],
+		Problems: problems,
+		Resource: labels[ResourceLabel],
+	}
 }
 
 func removeTrailingDot(name string) string {
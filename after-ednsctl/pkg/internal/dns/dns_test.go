@@ -0,0 +1,213 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistryRecordWithOwnerKeepsLabels(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{
+			content: `"heritage=external-dns,external-dns/owner=old,external-dns/resource=ingress/default/web"`,
+			want:    "heritage=external-dns,external-dns/owner=new,external-dns/resource=ingress/default/web",
+		},
+		{
+			content: `"heritage=external-dns,external-dns/owner=old,external-dns/resource=service/default/db,external-dns/db-record-type=cname"`,
+			want:    "heritage=external-dns,external-dns/owner=new,external-dns/resource=service/default/db,external-dns/db-record-type=cname",
+		},
+		{
+			content: `"heritage=external-dns,external-dns/owner=old"`,
+			want:    "heritage=external-dns,external-dns/owner=new",
+		},
+	}
+	for _, test := range tests {
+		labels, problems, err := ParseRegistryValue(test.content)
+		if err != nil {
+			t.Fatalf("ParseRegistryValue(%s) returned %v", test.content, err)
+		}
+		reg := newRegistryRecord("www.example.com", labels, problems)
+		moved := reg.WithOwner("new")
+		if got := moved.Value(); got != test.want {
+			t.Errorf("WithOwner(new) of %s is %s, want %s", test.content, got, test.want)
+		}
+		if moved.Owner != "new" || reg.Labels[OwnerLabel] != "old" {
+			t.Errorf("WithOwner changed the original labels or did not set the owner: %+v", moved)
+		}
+	}
+}
+
+func TestParseRecordsAndRegistryShareOneListing(t *testing.T) {
+	records := []Record{
+		{Name: "www.example.com.", Type: "CNAME", Targets: []string{"lb.example.net"}},
+		{Name: "api.example.com.", Type: "A", Targets: []string{"10.0.0.1"}},
+		{Name: "mail.example.com.", Type: "MX", Targets: []string{"10 mx.example.net"}},
+		{Name: "www.example.com.", Type: "TXT", Targets: []string{
+			`"v=spf1 -all"`,
+			`"heritage=external-dns,external-dns/resource=ingress/default/web"`,
+			`"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/web"`,
+		}},
+	}
+
+	parsed := ParseRecords(records)
+	if len(parsed) != 2 || parsed[0].Name != "api.example.com" || parsed[1].Name != "www.example.com" {
+		t.Errorf("ParseRecords returned %+v, want the A and CNAME records sorted without trailing dots", parsed)
+	}
+
+	registry := ParseRegistry(records, nil)
+	reg, exists := registry["www.example.com"]
+	if len(registry) != 1 || !exists {
+		t.Fatalf("ParseRegistry returned %+v, want only www.example.com", registry)
+	}
+	if reg.Owner != "default" || len(reg.Problems) != 0 {
+		t.Errorf("ParseRegistry kept %+v, want the well formed value owned by default", reg)
+	}
+}
+
+func TestParseRegistryValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		labels   map[string]string
+		problems []string
+		invalid  bool
+	}{
+		{
+			name:    "well formed",
+			content: `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/web"`,
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default", ResourceLabel: "ingress/default/web"},
+		},
+		{
+			name:    "unquoted",
+			content: "heritage=external-dns,external-dns/owner=default",
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default"},
+		},
+		{
+			name:    "multi-string",
+			content: `"heritage=external-dns,external-dns/owner=default," "external-dns/resource=service/default/db"`,
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default", ResourceLabel: "service/default/db"},
+		},
+		{
+			name:    "escaped quote",
+			content: `"heritage=external-dns,external-dns/owner=de\"fault"`,
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: `de"fault`},
+		},
+		{
+			name:    "equals sign in the resource",
+			content: `"heritage=external-dns,external-dns/owner=default,external-dns/resource=crd/default/a=b"`,
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default", ResourceLabel: "crd/default/a=b"},
+		},
+		{
+			name:    "unknown keys are kept",
+			content: `"heritage=external-dns,external-dns/owner=default,external-dns/web-record-type=cname"`,
+			labels:  map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default", "external-dns/web-record-type": "cname"},
+		},
+		{
+			name:     "empty label",
+			content:  `"heritage=external-dns,,external-dns/owner=default"`,
+			labels:   map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default"},
+			problems: []string{`label "" is not a key=value pair`},
+		},
+		{
+			name:     "keyless labels",
+			content:  `"heritage=external-dns,external-dns/owner=default,orphan,=value"`,
+			labels:   map[string]string{HeritageLabel: "external-dns", OwnerLabel: "default"},
+			problems: []string{`label "orphan" is not a key=value pair`, `label "=value" is not a key=value pair`},
+		},
+		{
+			name:     "repeated label",
+			content:  `"heritage=external-dns,external-dns/owner=a,external-dns/owner=b"`,
+			labels:   map[string]string{HeritageLabel: "external-dns", OwnerLabel: "b"},
+			problems: []string{"label external-dns/owner is set more than once"},
+		},
+		{
+			name:     "missing heritage and owner",
+			content:  `"external-dns/resource=ingress/default/web"`,
+			labels:   map[string]string{ResourceLabel: "ingress/default/web"},
+			problems: []string{"label heritage is missing", "label external-dns/owner is missing"},
+		},
+		{
+			name:     "foreign heritage",
+			content:  `"heritage=other,external-dns/owner=default"`,
+			labels:   map[string]string{HeritageLabel: "other", OwnerLabel: "default"},
+			problems: []string{`label heritage is "other" instead of external-dns`},
+		},
+		{
+			name:    "not a registry value",
+			content: `"v=spf1 include:example.net -all"`,
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		labels, problems, err := ParseRegistryValue(test.content)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: ParseRegistryValue(%s) returned no error", test.name, test.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseRegistryValue(%s) returned %v", test.name, test.content, err)
+			continue
+		}
+		if !reflect.DeepEqual(labels, test.labels) {
+			t.Errorf("%s: labels are %v, want %v", test.name, labels, test.labels)
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: problems are %q, want %q", test.name, problems, test.problems)
+		}
+	}
+}
+
+func TestUnquoteTXT(t *testing.T) {
+	tests := map[string]string{
+		`"a=b"`:             "a=b",
+		`"a=b," "c=d"`:      "a=b,c=d",
+		` "a=b" `:           "a=b",
+		`"a \"quoted\" b"`:  `a "quoted" b`,
+		`"back\\slash"`:     `back\slash`,
+		`a=b`:               "a=b",
+		`""`:                "",
+		`"a=b,""c=d"`:       "a=b,c=d",
+		`"trailing " space`: "trailing ",
+	}
+	for content, want := range tests {
+		if got := unquoteTXT(content); got != want {
+			t.Errorf("unquoteTXT(%s) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParseRegistryReportsProblems(t *testing.T) {
+	records := []Record{
+		{Name: "bad.example.com", Type: "TXT", Targets: []string{`"heritage=external-dns,external-dns/resource=ingress/default/bad"`}},
+		{Name: "fixed.example.com", Type: "TXT", Targets: []string{
+			`"heritage=external-dns,orphan,external-dns/owner=default"`,
+			`"heritage=external-dns,external-dns/owner=default"`,
+		}},
+	}
+	registry := ParseRegistry(records, nil)
+	bad := registry["bad.example.com"]
+	if want := []string{"label external-dns/owner is missing"}; !reflect.DeepEqual(bad.Problems, want) {
+		t.Errorf("bad.example.com has problems %q, want %q", bad.Problems, want)
+	}
+	if bad.Resource != "ingress/default/bad" {
+		t.Errorf("bad.example.com has resource %q, want the labels of the malformed value", bad.Resource)
+	}
+	if fixed := registry["fixed.example.com"]; len(fixed.Problems) != 0 {
+		t.Errorf("fixed.example.com has problems %q, want the well formed value", fixed.Problems)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrorKind classifies the errors returned by a provider so callers can
+// decide whether to retry, re-authenticate or give up
+type ErrorKind int
+
+const (
+	// UnknownError is used for errors that do not fit any other kind
+	UnknownError ErrorKind = iota
+	// AuthError means the provider rejected the credentials or their permissions
+	AuthError
+	// NotFoundError means the zone or record does not exist
+	NotFoundError
+	// RateLimitedError means the provider is throttling requests
+	RateLimitedError
+	// TransientError means the request failed in a way that may succeed when retried
+	TransientError
+)
+
+// Sentinel errors matching each ErrorKind with errors.Is
+var (
+	ErrAuth        = errors.New("authentication failed")
+	ErrNotFound    = errors.New("not found")
+	ErrRateLimited = errors.New("rate limited")
+	ErrTransient   = errors.New("transient failure")
+)
+
+// Error is returned by providers for every failed call to the provider API
+type Error struct {
+	Kind     ErrorKind
+	Provider string
+	Op       string // Op describes what was attempted e.g. "list records"
+	Err      error
+}
+
+// NewError returns an *Error of the given kind. UnknownError kinds are refined
+// from context and network errors.
+func NewError(provider, op string, kind ErrorKind, err error) error {
+	if kind == UnknownError {
+		kind = kindFromError(err)
+	}
+	return &Error{
+		Kind:     kind,
+		Provider: provider,
+		Op:       op,
+		Err:      err,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: could not %s: %v", e.Provider, e.Op, e.Err)
+}
+
+// Unwrap returns the underlying provider error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error of the error's kind
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		{
+			return e.Kind == AuthError
+		}
+	case ErrNotFound:
+		{
+			return e.Kind == NotFoundError
+		}
+	case ErrRateLimited:
+		{
+			return e.Kind == RateLimitedError
+		}
+	case ErrTransient:
+		{
+			return e.Kind == TransientError
+		}
+	default:
+		{
+			return false
+		}
+	}
+}
+
+// Temporary reports whether retrying the call may succeed
+func (e *Error) Temporary() bool {
+	return e.Kind == RateLimitedError || e.Kind == TransientError
+}
+
+// IsTemporary reports whether err is a provider error that may succeed when retried
+func IsTemporary(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Temporary()
+}
+
+// KindFromStatus maps an HTTP status code returned by a provider API to an ErrorKind
+func KindFromStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		{
+			return AuthError
+		}
+	case status == http.StatusNotFound:
+		{
+			return NotFoundError
+		}
+	case status == http.StatusTooManyRequests:
+		{
+			return RateLimitedError
+		}
+	case status >= 500:
+		{
+			return TransientError
+		}
+	default:
+		{
+			return UnknownError
+		}
+	}
+}
+
+func kindFromError(err error) ErrorKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return TransientError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return TransientError
+	}
+	return UnknownError
+}
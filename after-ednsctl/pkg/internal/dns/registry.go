@@ -0,0 +1,169 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"strings"
+)
+
+// RegistryFormat is the naming scheme of a TXT registry record
+type RegistryFormat string
+
+const (
+	// LegacyFormat registry records are named <prefix><label><suffix>.<domain>
+	LegacyFormat RegistryFormat = "legacy"
+	// RecordTypeFormat registry records are named <prefix><type>-<label><suffix>.<domain>
+	// e.g. a-www.example.com, or have the type in a %{record_type} prefix or suffix
+	RecordTypeFormat RegistryFormat = "record-type"
+)
+
+// RecordTypeTemplate is replaced with the lower case record type in registry prefixes and suffixes
+const RecordTypeTemplate = "%{record_type}"
+
+// NameMapper maps the names of records to the names of their TXT registry
+// records the same way external-dns does with --txt-prefix, --txt-suffix and
+// --txt-wildcard-replacement. The suffix is added to the first label of the name.
+type NameMapper struct {
+	Prefix              string
+	Suffix              string
+	WildcardReplacement string
+}
+
+// RegistryName returns the name of the TXT registry record of the given format
+// for the record with the given name and type
+func (m NameMapper) RegistryName(name, recordType string, format RegistryFormat) string {
+	recordType = strings.ToLower(recordType)
+	if format == LegacyFormat {
+		recordType = ""
+	}
+	label, domain := splitName(name)
+	if m.WildcardReplacement != "" && label == "*" {
+		label = m.WildcardReplacement
+	}
+	if format == RecordTypeFormat && !m.templated() {
+		label = recordType + "-" + label
+	}
+	return affix(m.Prefix, recordType) + label + affix(m.Suffix, recordType) + domain
+}
+
+// Lookup returns the registry record of the record with the given name and
+// type along with its format. Registry records in the record type format are
+// preferred over legacy ones, as external-dns does. An empty record type
+// matches the registry record of any of the RecordTypes.
+func (m NameMapper) Lookup(registry map[string]RegistryRecord, name, recordType string) (RegistryRecord, bool) {
+	types := []string{recordType}
+	if recordType == "" {
+		types = RecordTypes
+	}
+	for _, item := range types {
+		if reg, exists := registry[m.RegistryName(name, item, RecordTypeFormat)]; exists {
+			reg.Format = RecordTypeFormat
+			reg.RecordType = strings.ToUpper(item)
+			return reg, true
+		}
+	}
+	if reg, exists := registry[m.RegistryName(name, "", LegacyFormat)]; exists {
+		reg.Format = LegacyFormat
+		return reg, true
+	}
+	return RegistryRecord{}, false
+}
+
+// Resolve returns the name and type of the record the TXT registry record with
+// the given name belongs to, along with the format of the registry record. It
+// is the inverse of RegistryName. The record type is empty for the legacy
+// format and ok is false when the name was not built by the mapper. Legacy
+// registry records of labels starting with a record type and a dash, e.g.
+// a-www.example.com, can not be told apart from the record type format.
+func (m NameMapper) Resolve(registryName string) (name, recordType string, format RegistryFormat, ok bool) {
+	for _, item := range RecordTypes {
+		if name, ok := m.decode(registryName, item, RecordTypeFormat); ok {
+			return name, item, RecordTypeFormat, true
+		}
+	}
+	if name, ok := m.decode(registryName, "", LegacyFormat); ok {
+		return name, "", LegacyFormat, true
+	}
+	return "", "", "", false
+}
+
+// decode returns the name of the record of the given type and format that the
+// registry name was built for
+func (m NameMapper) decode(registryName, recordType string, format RegistryFormat) (string, bool) {
+	lowerType := strings.ToLower(recordType)
+	if format == LegacyFormat {
+		lowerType = ""
+	}
+	prefix, suffix := affix(m.Prefix, lowerType), affix(m.Suffix, lowerType)
+	if !strings.HasPrefix(registryName, prefix) {
+		return "", false
+	}
+	rest := registryName[len(prefix):]
+	end := strings.Index(rest, ".")
+	if end < 0 {
+		end = len(rest)
+	}
+	// the label holds no dots so the suffix starts at or before the first dot
+	// and is followed by the end of the name or the domain
+	var label, domain string
+	found := false
+	for i := 0; i <= end && i+len(suffix) <= len(rest); i++ {
+		if !strings.HasPrefix(rest[i:], suffix) {
+			continue
+		}
+		domain = rest[i+len(suffix):]
+		if domain == "" || strings.HasPrefix(domain, ".") {
+			label = rest[:i]
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+	if format == RecordTypeFormat && !m.templated() {
+		if !strings.HasPrefix(label, lowerType+"-") {
+			return "", false
+		}
+		label = label[len(lowerType)+1:]
+	}
+	if label == "" {
+		return "", false
+	}
+	if m.WildcardReplacement != "" && label == m.WildcardReplacement {
+		label = "*"
+	}
+	name := label + domain
+	if m.RegistryName(name, recordType, format) != registryName {
+		return "", false
+	}
+	return name, true
+}
+
+func (m NameMapper) templated() bool {
+	return strings.Contains(m.Prefix, RecordTypeTemplate) || strings.Contains(m.Suffix, RecordTypeTemplate)
+}
+
+// affix replaces the record type template in a prefix or suffix, dropping it
+// for legacy registry names
+func affix(value, recordType string) string {
+	return strings.Replace(value, RecordTypeTemplate, recordType, -1)
+}
+
+// splitName splits a name into its first label and the rest of the name,
+// which keeps its leading dot
+func splitName(name string) (label, domain string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
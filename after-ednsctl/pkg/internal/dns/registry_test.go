@@ -0,0 +1,77 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"testing"
+)
+
+func TestNameMapperRoundTrip(t *testing.T) {
+	mappers := []NameMapper{
+		{},
+		{Prefix: "txt."},
+		{Prefix: "txt-"},
+		{Suffix: "-txt"},
+		{Prefix: "%{record_type}-"},
+		{Suffix: "-%{record_type}"},
+		{Prefix: "txt.", WildcardReplacement: "wildcard"},
+		{Suffix: "-owner", WildcardReplacement: "any"},
+	}
+	names := []string{"www.example.com", "*.example.com", "a.b.example.com", "example"}
+	for _, mapper := range mappers {
+		for _, name := range names {
+			for _, recordType := range RecordTypes {
+				for _, format := range []RegistryFormat{RecordTypeFormat, LegacyFormat} {
+					registryName := mapper.RegistryName(name, recordType, format)
+					gotName, gotType, gotFormat, ok := mapper.Resolve(registryName)
+					wantType := recordType
+					if format == LegacyFormat {
+						wantType = ""
+					}
+					if !ok || gotName != name || gotType != wantType || gotFormat != format {
+						t.Errorf("%+v: Resolve(RegistryName(%s, %s, %s) = %s) = %s, %s, %s, %v", mapper, name, recordType, format, registryName, gotName, gotType, gotFormat, ok)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNameMapperRegistryName(t *testing.T) {
+	tests := []struct {
+		mapper NameMapper
+		name   string
+		format RegistryFormat
+		want   string
+	}{
+		{NameMapper{}, "www.example.com", LegacyFormat, "www.example.com"},
+		{NameMapper{}, "www.example.com", RecordTypeFormat, "cname-www.example.com"},
+		{NameMapper{Prefix: "txt."}, "www.example.com", RecordTypeFormat, "txt.cname-www.example.com"},
+		{NameMapper{Suffix: "-txt"}, "www.example.com", LegacyFormat, "www-txt.example.com"},
+		{NameMapper{Prefix: "%{record_type}."}, "www.example.com", RecordTypeFormat, "cname.www.example.com"},
+		{NameMapper{WildcardReplacement: "any"}, "*.example.com", RecordTypeFormat, "cname-any.example.com"},
+	}
+	for _, test := range tests {
+		if got := test.mapper.RegistryName(test.name, "CNAME", test.format); got != test.want {
+			t.Errorf("%+v: RegistryName(%s, CNAME, %s) = %s, want %s", test.mapper, test.name, test.format, got, test.want)
+		}
+	}
+}
+
+func TestNameMapperResolveRejectsForeignNames(t *testing.T) {
+	mapper := NameMapper{Prefix: "txt."}
+	for _, name := range []string{"www.example.com", "txt.", "other.cname-www.example.com"} {
+		if got, _, _, ok := mapper.Resolve(name); ok {
+			t.Errorf("Resolve(%s) = %s, want no match", name, got)
+		}
+	}
+}
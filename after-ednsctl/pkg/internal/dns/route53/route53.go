@@ -11,24 +11,383 @@
 
 package route53
 
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	r53 "github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+const provider = "route53"
+
 // API represents a connection to route53
 type API struct {
+	Client      route53iface.Route53API
+	RegistryKey []byte
+	Zone        string
+	ZoneID      string
+	// recordSets holds the listing of the last GetRecords call by recordSetKey
+	recordSets map[string]*r53.ResourceRecordSet
 }
 
-// NewAPI configures and returns a valid API object
-func NewAPI() *API {
-	var ret *API
-	return ret
+// NewAPI configures and returns a valid API object using the default AWS credential chain
+func NewAPI(ctx context.Context, zone string) (*API, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, newError("create AWS session", err)
+	}
+	return NewAPIWithClient(ctx, r53.New(sess), zone)
 }
 
-// GetRegistry represents the external-dns TXT registry in route53
-func (*API) GetRegistry() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
-	return ret
+// NewAPIWithClient returns an API object that talks to route53 through the given client
+func NewAPIWithClient(ctx context.Context, client route53iface.Route53API, zone string) (*API, error) {
+	api := API{
+		Client: client,
+		Zone:   zone,
+	}
+	id, err := api.getZoneID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	api.ZoneID = id
+	return &api, nil
+}
+
+// GetRecords returns every record set in the hosted zone. Alias record sets
+// have the alias target, without its trailing dot, as their only target, and
+// the \052 route53 returns for a wildcard is turned back into a *.
+func (a *API) GetRecords(ctx context.Context) ([]dns.Record, error) {
+	recordSets, err := a.getRecordSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.recordSets = make(map[string]*r53.ResourceRecordSet)
+	var ret []dns.Record
+	for _, item := range recordSets {
+		a.recordSets[recordSetKey(item)] = item
+		record := dns.Record{
+			Metadata: make(map[string]string),
+			Name:     wildcardUnescape(aws.StringValue(item.Name)),
+			TTL:      aws.Int64Value(item.TTL),
+			Type:     aws.StringValue(item.Type),
+		}
+		if item.AliasTarget != nil && aws.StringValue(item.AliasTarget.DNSName) != "" {
+			record.Metadata[dns.AliasMetadata] = "true"
+			record.Targets = []string{strings.TrimSuffix(aws.StringValue(item.AliasTarget.DNSName), ".")}
+		}
+		if item.SetIdentifier != nil {
+			record.Metadata[dns.SetIdentifierMetadata] = aws.StringValue(item.SetIdentifier)
+		}
+		for _, value := range item.ResourceRecords {
+			record.Targets = append(record.Targets, aws.StringValue(value.Value))
+		}
+		ret = append(ret, record)
+	}
+	return ret, nil
+}
+
+// SetRegistry upserts the TXT registry record with the given name in route53.
+// Any other values in the TXT record set are kept.
+func (a *API) SetRegistry(ctx context.Context, name, value string) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRegistryAction, Name: name, Value: value},
+	})
 }
 
-// GetRecords represents the external-dns records in route53
-func (*API) GetRecords() map[string]map[string]string {
-	var ret = make(map[string]map[string]string)
+// DeleteRegistry removes the TXT registry value with the given name from route53
+func (a *API) DeleteRegistry(ctx context.Context, name string) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRegistryAction, Name: name},
+	})
+}
+
+// SetRecord upserts the record in route53. Alias records can not be set as the
+// hosted zone of their target is not part of the record.
+func (a *API) SetRecord(ctx context.Context, record dns.Record) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRecordAction, Record: record},
+	})
+}
+
+// DeleteRecord deletes the record set with the same name and type from route53
+func (a *API) DeleteRecord(ctx context.Context, record dns.Record) error {
+	return a.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRecordAction, Record: record},
+	})
+}
+
+// ApplyBatch applies every change in a single ChangeResourceRecordSets request
+// so either all of them or none of them are made. The record sets the changes
+// replace are taken from the listing of the last GetRecords call, which is kept
+// up to date with the changes applied since, rather than requested one by one.
+func (a *API) ApplyBatch(ctx context.Context, changes []dns.Change) error {
+	var batch []*r53.Change
+	for _, change := range changes {
+		c, err := a.toChange(ctx, change)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			batch = append(batch, c)
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	input := r53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(a.ZoneID),
+		ChangeBatch: &r53.ChangeBatch{
+			Changes: batch,
+		},
+	}
+	_, err := a.Client.ChangeResourceRecordSetsWithContext(ctx, &input)
+	if err != nil {
+		return newError(fmt.Sprintf("apply %d changes", len(batch)), err)
+	}
+	if a.recordSets != nil {
+		for _, change := range batch {
+			if aws.StringValue(change.Action) == r53.ChangeActionDelete {
+				delete(a.recordSets, recordSetKey(change.ResourceRecordSet))
+			} else {
+				a.recordSets[recordSetKey(change.ResourceRecordSet)] = change.ResourceRecordSet
+			}
+		}
+	}
+	return nil
+}
+
+// toChange converts the change into a route53 change, returning nil when
+// there is nothing to do
+func (a *API) toChange(ctx context.Context, change dns.Change) (*r53.Change, error) {
+	switch change.Action {
+	case dns.SetRecordAction:
+		{
+			if change.Record.Alias() {
+				return nil, fmt.Errorf("The alias record %s %s can not be set, the hosted zone of its target is not known", change.Record.Type, change.Record.Name)
+			}
+			recordSet := r53.ResourceRecordSet{
+				Name: aws.String(change.Record.Name),
+				Type: aws.String(change.Record.Type),
+				TTL:  aws.Int64(change.Record.TTLOrDefault()),
+			}
+			for _, target := range change.Record.Targets {
+				recordSet.ResourceRecords = append(recordSet.ResourceRecords, &r53.ResourceRecord{
+					Value: aws.String(target),
+				})
+			}
+			if setIdentifier := change.Record.Metadata[dns.SetIdentifierMetadata]; setIdentifier != "" {
+				// the routing policy of the record set is not part of the record so
+				// it is kept from the existing one
+				existing, err := a.getRecordSet(ctx, change.Record.Name, change.Record.Type, setIdentifier)
+				if err != nil {
+					return nil, err
+				}
+				recordSet.SetIdentifier = aws.String(setIdentifier)
+				if existing != nil {
+					recordSet.Weight = existing.Weight
+					recordSet.Region = existing.Region
+					recordSet.Failover = existing.Failover
+					recordSet.GeoLocation = existing.GeoLocation
+					recordSet.MultiValueAnswer = existing.MultiValueAnswer
+					recordSet.HealthCheckId = existing.HealthCheckId
+				}
+			}
+			return upsert(&recordSet), nil
+		}
+	case dns.DeleteRecordAction:
+		{
+			existing, err := a.getRecordSet(ctx, change.Record.Name, change.Record.Type, change.Record.Metadata[dns.SetIdentifierMetadata])
+			if err != nil || existing == nil {
+				return nil, err
+			}
+			return remove(existing), nil
+		}
+	case dns.SetRegistryAction:
+		{
+			content, err := dns.RegistryContent(change.Value, a.RegistryKey)
+			if err != nil {
+				return nil, err
+			}
+			recordSet := r53.ResourceRecordSet{
+				Name: aws.String(change.Name),
+				Type: aws.String(r53.RRTypeTxt),
+				TTL:  aws.Int64(dns.RegistryTTL),
+				ResourceRecords: []*r53.ResourceRecord{
+					{Value: aws.String(content)},
+				},
+			}
+			existing, err := a.getRecordSet(ctx, change.Name, r53.RRTypeTxt, "")
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				recordSet.TTL = existing.TTL
+				recordSet.ResourceRecords = append(recordSet.ResourceRecords, a.nonRegistryValues(existing)...)
+			}
+			return upsert(&recordSet), nil
+		}
+	case dns.DeleteRegistryAction:
+		{
+			existing, err := a.getRecordSet(ctx, change.Name, r53.RRTypeTxt, "")
+			if err != nil || existing == nil {
+				return nil, err
+			}
+			remaining := a.nonRegistryValues(existing)
+			if len(remaining) == 0 {
+				return remove(existing), nil
+			}
+			return upsert(&r53.ResourceRecordSet{
+				Name:            existing.Name,
+				Type:            existing.Type,
+				TTL:             existing.TTL,
+				ResourceRecords: remaining,
+			}), nil
+		}
+	default:
+		{
+			return nil, fmt.Errorf("Unknown change action: %s", change.Action)
+		}
+	}
+}
+
+func upsert(recordSet *r53.ResourceRecordSet) *r53.Change {
+	return &r53.Change{
+		Action:            aws.String(r53.ChangeActionUpsert),
+		ResourceRecordSet: recordSet,
+	}
+}
+
+func remove(recordSet *r53.ResourceRecordSet) *r53.Change {
+	return &r53.Change{
+		Action:            aws.String(r53.ChangeActionDelete),
+		ResourceRecordSet: recordSet,
+	}
+}
+
+// nonRegistryValues returns the values of the TXT record set that are not external-dns registry values
+func (a *API) nonRegistryValues(recordSet *r53.ResourceRecordSet) []*r53.ResourceRecord {
+	var ret []*r53.ResourceRecord
+	for _, item := range recordSet.ResourceRecords {
+		if !dns.IsRegistryValue(aws.StringValue(item.Value), a.RegistryKey) {
+			ret = append(ret, item)
+		}
+	}
 	return ret
 }
+
+// wildcardUnescape replaces the octal escape route53 uses for * in record names
+func wildcardUnescape(name string) string {
+	return strings.Replace(name, "\\052", "*", -1)
+}
+
+func (a *API) getZoneID(ctx context.Context) (string, error) {
+	input := r53.ListHostedZonesByNameInput{
+		DNSName: aws.String(a.Zone),
+	}
+	output, err := a.Client.ListHostedZonesByNameWithContext(ctx, &input)
+	if err != nil {
+		return "", newError("list hosted zones", err)
+	}
+	for _, zone := range output.HostedZones {
+		if aws.StringValue(zone.Name) == a.Zone+"." {
+			return aws.StringValue(zone.Id), nil
+		}
+	}
+	return "", dns.NewError(provider, "find hosted zone "+a.Zone, dns.NotFoundError, dns.ErrNotFound)
+}
+
+// getRecordSet returns the record set with the given name, type and set
+// identifier or nil if it does not exist. Weighted, latency and failover record
+// sets share their name and type, so an empty set identifier only matches a
+// record set without one. The record set is only requested from route53 when
+// GetRecords has not listed the zone yet.
+func (a *API) getRecordSet(ctx context.Context, name, recordType, setIdentifier string) (*r53.ResourceRecordSet, error) {
+	if a.recordSets != nil {
+		return a.recordSets[recordSetKey(&r53.ResourceRecordSet{
+			Name:          aws.String(name),
+			Type:          aws.String(recordType),
+			SetIdentifier: aws.String(setIdentifier),
+		})], nil
+	}
+	input := r53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(a.ZoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String(recordType),
+		MaxItems:        aws.String("1"),
+	}
+	if setIdentifier != "" {
+		input.StartRecordIdentifier = aws.String(setIdentifier)
+	}
+	output, err := a.Client.ListResourceRecordSetsWithContext(ctx, &input)
+	if err != nil {
+		return nil, newError(fmt.Sprintf("get %s record %s", recordType, name), err)
+	}
+	for _, item := range output.ResourceRecordSets {
+		if strings.TrimSuffix(wildcardUnescape(aws.StringValue(item.Name)), ".") == strings.TrimSuffix(name, ".") &&
+			aws.StringValue(item.Type) == recordType && aws.StringValue(item.SetIdentifier) == setIdentifier {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordSetKey identifies a record set by its name, type and set identifier
+func recordSetKey(recordSet *r53.ResourceRecordSet) string {
+	name := strings.ToLower(strings.TrimSuffix(wildcardUnescape(aws.StringValue(recordSet.Name)), "."))
+	return name + " " + aws.StringValue(recordSet.Type) + " " + aws.StringValue(recordSet.SetIdentifier)
+}
+
+func (a *API) getRecordSets(ctx context.Context) ([]*r53.ResourceRecordSet, error) {
+	var ret []*r53.ResourceRecordSet
+	input := r53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(a.ZoneID),
+	}
+	err := a.Client.ListResourceRecordSetsPagesWithContext(ctx, &input, func(page *r53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		ret = append(ret, page.ResourceRecordSets...)
+		return true
+	})
+	if err != nil {
+		return nil, newError("list records", err)
+	}
+	return ret, nil
+}
+
+// newError classifies an error returned by the AWS SDK
+func newError(op string, err error) error {
+	kind := dns.UnknownError
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		kind = dns.KindFromStatus(reqErr.StatusCode())
+	}
+	awsErr, isAWSErr := err.(awserr.Error)
+	if isAWSErr {
+		switch awsErr.Code() {
+		case r53.ErrCodeNoSuchHostedZone:
+			{
+				kind = dns.NotFoundError
+			}
+		case "AccessDenied", "ExpiredToken", "InvalidClientTokenId", "NoCredentialProviders", "SignatureDoesNotMatch":
+			{
+				kind = dns.AuthError
+			}
+		}
+	}
+	switch {
+	case request.IsErrorThrottle(err):
+		{
+			kind = dns.RateLimitedError
+		}
+	// the SDK retries every error it does not know, so only its own errors are checked
+	case kind == dns.UnknownError && isAWSErr && request.IsErrorRetryable(err):
+		{
+			kind = dns.TransientError
+		}
+	}
+	return dns.NewError(provider, op, kind, err)
+}
@@ -0,0 +1,587 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route53
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	r53 "github.com/aws/aws-sdk-go/service/route53"
+	"github.com/lucasreed/go-interface-refactoring/after-ednsctl/pkg/internal/dns"
+)
+
+// xmlRecordSet is a resource record set as route53 writes it in its responses
+// and reads it in change batches
+type xmlRecordSet struct {
+	Name            string
+	Type            string
+	SetIdentifier   string     `xml:",omitempty"`
+	Weight          *int64     `xml:",omitempty"`
+	TTL             *int64     `xml:",omitempty"`
+	ResourceRecords []xmlValue `xml:"ResourceRecords>ResourceRecord"`
+	AliasTarget     *xmlAlias  `xml:",omitempty"`
+}
+
+type xmlValue struct {
+	Value string
+}
+
+// values returns the values of the resource records of the record set
+func (s xmlRecordSet) values() []string {
+	var ret []string
+	for _, item := range s.ResourceRecords {
+		ret = append(ret, item.Value)
+	}
+	return ret
+}
+
+type xmlAlias struct {
+	HostedZoneId         string
+	DNSName              string
+	EvaluateTargetHealth bool
+}
+
+type xmlChange struct {
+	Action            string
+	ResourceRecordSet xmlRecordSet
+}
+
+type xmlChangeRequest struct {
+	Changes []xmlChange `xml:"ChangeBatch>Changes>Change"`
+}
+
+type xmlListResponse struct {
+	XMLName              xml.Name       `xml:"ListResourceRecordSetsResponse"`
+	ResourceRecordSets   []xmlRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated          bool
+	MaxItems             string
+	NextRecordName       string `xml:",omitempty"`
+	NextRecordType       string `xml:",omitempty"`
+	NextRecordIdentifier string `xml:",omitempty"`
+}
+
+type xmlZone struct {
+	Id              string
+	Name            string
+	CallerReference string
+}
+
+type xmlZonesResponse struct {
+	XMLName     xml.Name  `xml:"ListHostedZonesByNameResponse"`
+	HostedZones []xmlZone `xml:"HostedZones>HostedZone"`
+	IsTruncated bool
+	MaxItems    string
+}
+
+type xmlErrorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// fakeRoute53 is a stand-in for the route53 REST api serving the example.com.
+// hosted zone. Record sets are listed pageSize at a time with the Next* markers
+// route53 uses, change batches are applied to the record sets and every request
+// fails with errorCode and status when they are set.
+type fakeRoute53 struct {
+	mu        sync.Mutex
+	sets      []xmlRecordSet
+	changes   [][]xmlChange
+	pageSize  int
+	lists     int // lists counts the ListResourceRecordSets requests
+	status    int
+	errorCode string
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		xml.NewEncoder(w).Encode(xmlErrorResponse{Type: "Sender", Code: f.errorCode, Message: "failed", RequestID: "req"})
+		return
+	}
+	switch {
+	case r.URL.Path == "/2013-04-01/hostedzonesbyname":
+		{
+			xml.NewEncoder(w).Encode(xmlZonesResponse{
+				HostedZones: []xmlZone{
+					{Id: "/hostedzone/Z1", Name: "example.com.", CallerReference: "a"},
+					{Id: "/hostedzone/Z2", Name: "sub.example.com.", CallerReference: "b"},
+				},
+				MaxItems: "100",
+			})
+		}
+	case r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset" && r.Method == http.MethodGet:
+		{
+			f.lists++
+			f.list(w, r)
+		}
+	case r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset/" && r.Method == http.MethodPost:
+		{
+			var request xmlChangeRequest
+			if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.apply(request.Changes)
+			f.changes = append(f.changes, request.Changes)
+			fmt.Fprint(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2019-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+		}
+	default:
+		{
+			w.WriteHeader(http.StatusNotFound)
+			xml.NewEncoder(w).Encode(xmlErrorResponse{Type: "Sender", Code: "NoSuchHostedZone", Message: r.URL.Path})
+		}
+	}
+}
+
+func (f *fakeRoute53) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start := 0
+	if name := query.Get("name"); name != "" {
+		start = len(f.sets)
+		for i, set := range f.sets {
+			if sameName(set.Name, name) && set.Type == query.Get("type") &&
+				(query.Get("identifier") == "" || set.SetIdentifier == query.Get("identifier")) {
+				start = i
+				break
+			}
+		}
+	}
+	pageSize := f.pageSize
+	if max, err := strconv.Atoi(query.Get("maxitems")); err == nil && (pageSize == 0 || max < pageSize) {
+		pageSize = max
+	}
+	if pageSize == 0 {
+		pageSize = 100
+	}
+	resp := xmlListResponse{MaxItems: strconv.Itoa(pageSize)}
+	end := start + pageSize
+	if end >= len(f.sets) {
+		end = len(f.sets)
+	} else {
+		next := f.sets[end]
+		resp.IsTruncated = true
+		resp.NextRecordName = next.Name
+		resp.NextRecordType = next.Type
+		resp.NextRecordIdentifier = next.SetIdentifier
+	}
+	resp.ResourceRecordSets = f.sets[start:end]
+	xml.NewEncoder(w).Encode(resp)
+}
+
+// apply makes the changes to the record sets, UPSERTs replace the record set
+// with the same name, type and set identifier
+func (f *fakeRoute53) apply(changes []xmlChange) {
+	for _, change := range changes {
+		set := change.ResourceRecordSet
+		index := -1
+		for i, item := range f.sets {
+			if sameName(item.Name, set.Name) && item.Type == set.Type && item.SetIdentifier == set.SetIdentifier {
+				index = i
+			}
+		}
+		switch {
+		case change.Action == r53.ChangeActionDelete && index >= 0:
+			{
+				f.sets = append(f.sets[:index], f.sets[index+1:]...)
+			}
+		case change.Action == r53.ChangeActionUpsert && index >= 0:
+			{
+				f.sets[index] = set
+			}
+		case change.Action == r53.ChangeActionUpsert:
+			{
+				f.sets = append(f.sets, set)
+			}
+		}
+	}
+}
+
+func sameName(a, b string) bool {
+	return strings.TrimSuffix(wildcardUnescape(a), ".") == strings.TrimSuffix(wildcardUnescape(b), ".")
+}
+
+func recordSet(name, recordType string, values ...string) xmlRecordSet {
+	ret := xmlRecordSet{
+		Name: name,
+		Type: recordType,
+		TTL:  aws.Int64(300),
+	}
+	for _, value := range values {
+		ret.ResourceRecords = append(ret.ResourceRecords, xmlValue{Value: value})
+	}
+	return ret
+}
+
+// newTestClient returns a route53 client of the AWS SDK talking to an httptest
+// server backed by fake, without retries so errors come back straight away
+func newTestClient(t *testing.T, fake *fakeRoute53) (*r53.Route53, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-east-1"),
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewSession returned %v", err)
+	}
+	return r53.New(sess), server
+}
+
+func newTestAPI(t *testing.T, fake *fakeRoute53) (*API, *httptest.Server) {
+	t.Helper()
+	client, server := newTestClient(t, fake)
+	api, err := NewAPIWithClient(context.Background(), client, "example.com")
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewAPIWithClient returned %v", err)
+	}
+	return api, server
+}
+
+func TestNewAPIWithClientFindsZoneID(t *testing.T) {
+	api, server := newTestAPI(t, &fakeRoute53{})
+	defer server.Close()
+	if api.ZoneID != "/hostedzone/Z1" {
+		t.Errorf("ZoneID = %q, want /hostedzone/Z1", api.ZoneID)
+	}
+
+	_, err := NewAPIWithClient(context.Background(), api.Client, "missing.com")
+	if !errors.Is(err, dns.ErrNotFound) {
+		t.Errorf("missing zone returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetRecordsReadsEveryPage(t *testing.T) {
+	weighted := func(setIdentifier, value string) xmlRecordSet {
+		ret := recordSet("w.example.com.", "CNAME", value)
+		ret.SetIdentifier = setIdentifier
+		ret.Weight = aws.Int64(50)
+		return ret
+	}
+	fake := &fakeRoute53{pageSize: 2, sets: []xmlRecordSet{
+		recordSet("a.example.com.", "A", "1.1.1.1", "2.2.2.2"),
+		recordSet("b.example.com.", "CNAME", "lb.example.net"),
+		recordSet("c.example.com.", "TXT", `"heritage=external-dns"`),
+		weighted("blue", "blue.example.net"),
+		weighted("green", "green.example.net"),
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+
+	records, err := api.GetRecords(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, fmt.Sprintf("%s %s %s %s", record.Name, record.Type, record.Target(), record.Metadata[dns.SetIdentifierMetadata]))
+	}
+	want := []string{
+		"a.example.com. A 1.1.1.1,2.2.2.2 ",
+		"b.example.com. CNAME lb.example.net ",
+		"c.example.com. TXT \"heritage=external-dns\" ",
+		"w.example.com. CNAME blue.example.net blue",
+		"w.example.com. CNAME green.example.net green",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GetRecords returned\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if fake.lists != 3 {
+		t.Errorf("GetRecords made %d list requests, want 3", fake.lists)
+	}
+}
+
+func TestGetRecordsAliasTargets(t *testing.T) {
+	alias := recordSet("www.example.com.", "A")
+	alias.TTL = nil
+	alias.AliasTarget = &xmlAlias{HostedZoneId: "Z35SXDOTRQ7X7K", DNSName: "dualstack.lb-1.us-east-1.elb.amazonaws.com."}
+	alias.SetIdentifier = "blue"
+	alias.Weight = aws.Int64(1)
+	api, server := newTestAPI(t, &fakeRoute53{sets: []xmlRecordSet{alias}})
+	defer server.Close()
+
+	records, err := api.GetRecords(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	record := records[0]
+	if !record.Alias() || record.Metadata[dns.AliasMetadata] != "true" {
+		t.Errorf("record is not an alias: %v", record.Metadata)
+	}
+	if got := record.Target(); got != "dualstack.lb-1.us-east-1.elb.amazonaws.com" {
+		t.Errorf("target = %q, want the alias target without its trailing dot", got)
+	}
+	if record.Metadata[dns.SetIdentifierMetadata] != "blue" {
+		t.Errorf("set identifier = %q, want blue", record.Metadata[dns.SetIdentifierMetadata])
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+		want   error
+	}{
+		{http.StatusForbidden, "AccessDenied", dns.ErrAuth},
+		{http.StatusForbidden, "SignatureDoesNotMatch", dns.ErrAuth},
+		{http.StatusNotFound, r53.ErrCodeNoSuchHostedZone, dns.ErrNotFound},
+		{http.StatusBadRequest, "Throttling", dns.ErrRateLimited},
+		{http.StatusBadRequest, r53.ErrCodePriorRequestNotComplete, dns.ErrRateLimited},
+		{http.StatusInternalServerError, "InternalFailure", dns.ErrTransient},
+		{http.StatusServiceUnavailable, "ServiceUnavailable", dns.ErrTransient},
+	}
+	for _, test := range tests {
+		client, server := newTestClient(t, &fakeRoute53{status: test.status, errorCode: test.code})
+		_, err := NewAPIWithClient(context.Background(), client, "example.com")
+		server.Close()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%d %s returned %v, want %v", test.status, test.code, err, test.want)
+		}
+		var reqErr awserr.RequestFailure
+		if !errors.As(err, &reqErr) || reqErr.StatusCode() != test.status || reqErr.Code() != test.code {
+			t.Errorf("%d %s did not come back as a request failure: %v", test.status, test.code, err)
+		}
+	}
+}
+
+func TestNewErrorKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no credentials", awserr.New("NoCredentialProviders", "no creds", nil), dns.ErrAuth},
+		{"deadline", context.DeadlineExceeded, dns.ErrTransient},
+	}
+	for _, test := range tests {
+		err := newError("list records", test.err)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: newError returned %v, want %v", test.name, err, test.want)
+		}
+	}
+	err := newError("list records", errors.New("boom"))
+	var e *dns.Error
+	if !errors.As(err, &e) || e.Kind != dns.UnknownError || e.Temporary() {
+		t.Errorf("unknown error classified as %v", err)
+	}
+}
+
+func TestWeightedRecordSetsMatchSetIdentifier(t *testing.T) {
+	weighted := func(setIdentifier string, weight int64, value string) xmlRecordSet {
+		ret := recordSet("www.example.com.", "CNAME", value)
+		ret.SetIdentifier = setIdentifier
+		ret.Weight = aws.Int64(weight)
+		return ret
+	}
+	fake := &fakeRoute53{sets: []xmlRecordSet{
+		weighted("blue", 90, "blue.example.net"),
+		weighted("green", 10, "green.example.net"),
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+	green := dns.Record{
+		Metadata: map[string]string{dns.SetIdentifierMetadata: "green"},
+		Name:     "www.example.com",
+		Targets:  []string{"green2.example.net"},
+		Type:     "CNAME",
+	}
+
+	if err := api.SetRecord(ctx, green); err != nil {
+		t.Fatalf("SetRecord returned %v", err)
+	}
+	if err := api.DeleteRecord(ctx, green); err != nil {
+		t.Fatalf("DeleteRecord returned %v", err)
+	}
+	if len(fake.changes) != 2 {
+		t.Fatalf("%d change batches were sent, want 2", len(fake.changes))
+	}
+	set := fake.changes[0][0].ResourceRecordSet
+	if set.SetIdentifier != "green" || aws.Int64Value(set.Weight) != 10 {
+		t.Errorf("SetRecord sent set identifier %q and weight %d, want green and 10", set.SetIdentifier, aws.Int64Value(set.Weight))
+	}
+	deleted := fake.changes[1][0]
+	if deleted.Action != r53.ChangeActionDelete || deleted.ResourceRecordSet.SetIdentifier != "green" {
+		t.Errorf("DeleteRecord sent %s of set identifier %q, want DELETE of green", deleted.Action, deleted.ResourceRecordSet.SetIdentifier)
+	}
+
+	// a record without a set identifier does not match the weighted record sets
+	if err := api.DeleteRecord(ctx, dns.Record{Name: "www.example.com", Type: "CNAME"}); err != nil {
+		t.Fatalf("DeleteRecord returned %v", err)
+	}
+	if len(fake.changes) != 2 {
+		t.Errorf("DeleteRecord without a set identifier sent %v", fake.changes[2])
+	}
+	if len(fake.sets) != 1 || fake.sets[0].SetIdentifier != "blue" {
+		t.Errorf("the record sets left are %+v, want only blue", fake.sets)
+	}
+}
+
+func TestGetRecordsUnescapesWildcards(t *testing.T) {
+	fake := &fakeRoute53{sets: []xmlRecordSet{
+		recordSet("\\052.example.com.", "CNAME", "lb.example.net"),
+		recordSet("\\052.example.com.", "TXT", `"heritage=external-dns,external-dns/owner=default"`),
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	records, err := api.GetRecords(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	for _, record := range records {
+		if record.Name != "*.example.com." {
+			t.Errorf("GetRecords returned name %q, want *.example.com.", record.Name)
+		}
+	}
+
+	if err := api.DeleteRegistry(context.Background(), "*.example.com"); err != nil {
+		t.Fatalf("DeleteRegistry returned %v", err)
+	}
+	if len(fake.changes) != 1 {
+		t.Errorf("DeleteRegistry of the wildcard sent %d change batches, want 1", len(fake.changes))
+	}
+}
+
+func TestEncryptedRegistryValuesAreReplaced(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	old, err := dns.RegistryContent(dns.RegistryValue("old", "service/default/a"), key)
+	if err != nil {
+		t.Fatalf("RegistryContent returned %v", err)
+	}
+	fake := &fakeRoute53{sets: []xmlRecordSet{
+		recordSet("a.example.com.", "TXT", `"v=spf1 -all"`, old),
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	api.RegistryKey = key
+
+	value := dns.RegistryValue("new", "service/default/a")
+	if err := api.SetRegistry(context.Background(), "a.example.com", value); err != nil {
+		t.Fatalf("SetRegistry returned %v", err)
+	}
+	if err := api.DeleteRegistry(context.Background(), "a.example.com"); err != nil {
+		t.Fatalf("DeleteRegistry returned %v", err)
+	}
+	values := fake.changes[0][0].ResourceRecordSet.values()
+	if len(values) != 2 || values[1] != `"v=spf1 -all"` {
+		t.Fatalf("SetRegistry sent %v, want the new value and the spf value", values)
+	}
+	if plain, err := dns.DecryptValue(values[0], key); err != nil || plain != value {
+		t.Errorf("SetRegistry sent %s which decrypts to %q (%v), want %q", values[0], plain, err, value)
+	}
+	remaining := fake.changes[1][0].ResourceRecordSet.values()
+	if len(remaining) != 1 || remaining[0] != `"v=spf1 -all"` {
+		t.Errorf("DeleteRegistry kept %v, want only the spf value", remaining)
+	}
+}
+
+func TestSetRecordRejectsAliases(t *testing.T) {
+	fake := &fakeRoute53{}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+
+	err := api.SetRecord(context.Background(), dns.Record{
+		Metadata: map[string]string{dns.AliasMetadata: "true"},
+		Name:     "www.example.com",
+		Targets:  []string{"lb-1.us-east-1.elb.amazonaws.com"},
+		Type:     "A",
+	})
+	if err == nil {
+		t.Errorf("SetRecord of an alias record returned no error")
+	}
+	if len(fake.changes) != 0 {
+		t.Errorf("SetRecord of an alias record sent %v", fake.changes)
+	}
+}
+
+func TestApplyBatchUsesTheZoneListing(t *testing.T) {
+	fake := &fakeRoute53{sets: []xmlRecordSet{
+		recordSet("www.example.com.", "A", "10.0.0.1"),
+		recordSet("www.example.com.", "TXT", `"v=spf1 -all"`),
+		recordSet("old.example.com.", "CNAME", "lb.example.net"),
+		recordSet("old.example.com.", "TXT", dns.QuoteValue(dns.RegistryValue("default", "service/default/old"))),
+	}}
+	api, server := newTestAPI(t, fake)
+	defer server.Close()
+	ctx := context.Background()
+	if _, err := api.GetRecords(ctx); err != nil {
+		t.Fatalf("GetRecords returned %v", err)
+	}
+	lists := fake.lists
+
+	value := dns.RegistryValue("default", "service/default/www")
+	err := api.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.SetRecordAction, Record: dns.Record{Name: "www.example.com", Type: "A", Targets: []string{"10.0.0.2"}}},
+		{Action: dns.SetRegistryAction, Name: "www.example.com", Value: value},
+		{Action: dns.DeleteRecordAction, Record: dns.Record{Name: "old.example.com", Type: "CNAME"}},
+		{Action: dns.DeleteRegistryAction, Name: "old.example.com"},
+		{Action: dns.SetRecordAction, Record: dns.Record{Name: "new.example.com", Type: "A", Targets: []string{"10.0.0.3"}}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch returned %v", err)
+	}
+	if fake.lists != lists {
+		t.Errorf("ApplyBatch made %d list requests, want none", fake.lists-lists)
+	}
+	if len(fake.changes) != 1 || len(fake.changes[0]) != 5 {
+		t.Fatalf("ApplyBatch sent %v, want one batch of 5 changes", fake.changes)
+	}
+	want := map[string]string{
+		"www.example.com A":   "10.0.0.2",
+		"www.example.com TXT": dns.QuoteValue(value) + " " + `"v=spf1 -all"`,
+		"new.example.com A":   "10.0.0.3",
+	}
+	if len(fake.sets) != len(want) {
+		t.Errorf("the record sets left are %+v, want %v", fake.sets, want)
+	}
+	for _, set := range fake.sets {
+		key := strings.TrimSuffix(set.Name, ".") + " " + set.Type
+		if got := strings.Join(set.values(), " "); got != want[key] {
+			t.Errorf("%s %s is %q, want %q", set.Type, set.Name, got, want[key])
+		}
+	}
+
+	// the listing follows the applied changes, so the next batch deletes the
+	// record set that was just added
+	err = api.ApplyBatch(ctx, []dns.Change{
+		{Action: dns.DeleteRecordAction, Record: dns.Record{Name: "new.example.com", Type: "A"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch returned %v", err)
+	}
+	if len(fake.changes) != 2 || len(fake.changes[1]) != 1 || fake.changes[1][0].Action != r53.ChangeActionDelete {
+		t.Fatalf("the second ApplyBatch sent %v, want one DELETE", fake.changes[1:])
+	}
+	if fake.lists != lists {
+		t.Errorf("ApplyBatch made %d list requests, want none", fake.lists-lists)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	annotationAccessKey                string = "external-dns.alpha.kubernetes.io/access"
+	annotationAliasKey                 string = "external-dns.alpha.kubernetes.io/alias"
+	annotationControllerKey            string = "external-dns.alpha.kubernetes.io/controller"
+	annotationIngressHostnameSourceKey string = "external-dns.alpha.kubernetes.io/ingress-hostname-source"
+	annotationInternalHostnameKey      string = "external-dns.alpha.kubernetes.io/internal-hostname"
+	annotationSetIdentifierKey         string = "external-dns.alpha.kubernetes.io/set-identifier"
+	annotationTargetKey                string = "external-dns.alpha.kubernetes.io/target"
+	annotationTTLKey                   string = "external-dns.alpha.kubernetes.io/ttl"
+
+	// controllerValue is the controller annotation value of resources handled by external-dns
+	controllerValue = "dns-controller"
+)
+
+// isManaged reports whether external-dns handles the resource. Resources with
+// a controller annotation naming another controller are skipped.
+func isManaged(annotations map[string]string) bool {
+	controller, exists := annotations[annotationControllerKey]
+	return !exists || controller == controllerValue
+}
+
+// splitAnnotation returns the comma separated values of the annotation without
+// their trailing dots
+func splitAnnotation(annotations map[string]string, key string) []string {
+	var ret []string
+	for _, value := range strings.Split(annotations[key], ",") {
+		value = strings.TrimSuffix(strings.TrimSpace(value), ".")
+		if value != "" {
+			ret = append(ret, value)
+		}
+	}
+	return ret
+}
+
+// ingressHostnames returns the hostnames of the ingress rules and of the
+// hostname annotation, limited by the ingress-hostname-source annotation
+func ingressHostnames(item ingress) []string {
+	switch item.Annotations[annotationIngressHostnameSourceKey] {
+	case "defined-hosts-only":
+		{
+			return item.Hosts
+		}
+	case "annotation-only":
+		{
+			return splitAnnotation(item.Annotations, annotationHostnameKey)
+		}
+	default:
+		{
+			return append(append([]string{}, item.Hosts...), splitAnnotation(item.Annotations, annotationHostnameKey)...)
+		}
+	}
+}
+
+// targetsOrOverride returns the targets of the target annotation if it is set
+func targetsOrOverride(annotations map[string]string, targets []string) []string {
+	if override := splitAnnotation(annotations, annotationTargetKey); len(override) > 0 {
+		return override
+	}
+	return targets
+}
+
+// withAnnotations sets the record settings external-dns reads from the
+// annotations of the resource
+func withAnnotations(resource Resource, annotations map[string]string) Resource {
+	resource.Alias = annotations[annotationAliasKey] == "true"
+	resource.SetIdentifier = annotations[annotationSetIdentifierKey]
+	resource.TTL = ttlFromAnnotation(annotations)
+	return resource
+}
+
+// ttlFromAnnotation returns the TTL in seconds set by the ttl annotation, which
+// holds either seconds or a duration such as 1m. Invalid TTLs are ignored as
+// external-dns does.
+func ttlFromAnnotation(annotations map[string]string) int64 {
+	value, exists := annotations[annotationTTLKey]
+	if !exists {
+		return 0
+	}
+	ttl, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return 0
+		}
+		ttl = int64(duration.Seconds())
+	}
+	if ttl < 1 || ttl > math.MaxInt32 {
+		return 0
+	}
+	return ttl
+}
+
+// serviceTargets returns the targets external-dns gives the records of the
+// service: its load balancers, the addresses of the nodes for NodePort services
+// chosen by the access annotation, or its external name
+func (k *Kube) serviceTargets(ctx context.Context, service corev1.Service) ([]string, error) {
+	switch service.Spec.Type {
+	case corev1.ServiceTypeNodePort:
+		{
+			// only list the nodes when external-dns makes records for the service
+			if len(splitAnnotation(service.Annotations, annotationHostnameKey)) == 0 {
+				return nil, nil
+			}
+			return k.nodeTargets(ctx, service.Annotations[annotationAccessKey])
+		}
+	case corev1.ServiceTypeExternalName:
+		{
+			return []string{service.Spec.ExternalName}, nil
+		}
+	default:
+		{
+			return statusTargets(service.Status.LoadBalancer), nil
+		}
+	}
+}
+
+// nodeTargets returns the external addresses of the nodes, or their internal
+// addresses when access is private or none of them has an external address
+// and access is not public
+func (k *Kube) nodeTargets(ctx context.Context, access string) ([]string, error) {
+	if k.nodes == nil {
+		nodes, err := k.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Error getting nodes: %v", err)
+		}
+		k.nodes = nodes.Items
+	}
+	var external, internal []string
+	for _, node := range k.nodes {
+		for _, address := range node.Status.Addresses {
+			switch address.Type {
+			case corev1.NodeExternalIP:
+				{
+					external = appendMissing(external, address.Address)
+				}
+			case corev1.NodeInternalIP:
+				{
+					internal = appendMissing(internal, address.Address)
+				}
+			}
+		}
+	}
+	if access == "private" || (len(external) == 0 && access != "public") {
+		return internal, nil
+	}
+	return external, nil
+}
+
+// addHosts adds the hostnames that are in the domain to hosts once each
+func (k *Kube) addHosts(hosts Hostnames, resource Resource, hostnames []string) {
+	seen := make(map[Hostname]bool)
+	for _, host := range hostsInDomain(hostnames, k.Domain, k.IgnoredSubDomains) {
+		if !seen[host] {
+			seen[host] = true
+			hosts[host] = append(hosts[host], resource)
+		}
+	}
+}
+
+// addValidTargets records the targets as belonging to the resource
+func (k *Kube) addValidTargets(targets []string, resource string) {
+	for _, target := range targets {
+		k.ValidTargets[target] = append(k.ValidTargets[target], resource)
+	}
+}
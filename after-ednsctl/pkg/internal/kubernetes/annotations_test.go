@@ -0,0 +1,183 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSplitAnnotation(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "a.example.com", want: []string{"a.example.com"}},
+		{value: "a.example.com.", want: []string{"a.example.com"}},
+		{value: "a.example.com, b.example.com.,c.example.com", want: []string{"a.example.com", "b.example.com", "c.example.com"}},
+		{value: " a.example.com ,, ", want: []string{"a.example.com"}},
+		{value: ""},
+	}
+	for _, test := range tests {
+		annotations := map[string]string{annotationHostnameKey: test.value}
+		if got := splitAnnotation(annotations, annotationHostnameKey); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitAnnotation(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+	if got := splitAnnotation(nil, annotationHostnameKey); got != nil {
+		t.Errorf("splitAnnotation without annotations = %v", got)
+	}
+}
+
+func TestIngressHostnames(t *testing.T) {
+	hosts := []string{"a.example.com", "b.example.com"}
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{source: "", want: []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}},
+		{source: "defined-hosts-only", want: []string{"a.example.com", "b.example.com"}},
+		{source: "annotation-only", want: []string{"c.example.com", "d.example.com"}},
+	}
+	for _, test := range tests {
+		item := ingress{
+			Annotations: map[string]string{annotationHostnameKey: "c.example.com,d.example.com."},
+			Hosts:       hosts,
+		}
+		if test.source != "" {
+			item.Annotations[annotationIngressHostnameSourceKey] = test.source
+		}
+		if got := ingressHostnames(item); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ingressHostnames with source %q = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestTTLFromAnnotation(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{value: "300", want: 300},
+		{value: "1m", want: 60},
+		{value: "1h30m", want: 5400},
+		{value: "1", want: 1},
+		{value: "0"},
+		{value: "-60"},
+		{value: "500ms"},
+		{value: "2147483648"},
+		{value: "9999999h"},
+		{value: "five minutes"},
+		{value: ""},
+	}
+	for _, test := range tests {
+		if got := ttlFromAnnotation(map[string]string{annotationTTLKey: test.value}); got != test.want {
+			t.Errorf("ttlFromAnnotation(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+	if got := ttlFromAnnotation(nil); got != 0 {
+		t.Errorf("ttlFromAnnotation without annotations = %d", got)
+	}
+}
+
+func TestIsManaged(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		want        bool
+	}{
+		{annotations: nil, want: true},
+		{annotations: map[string]string{annotationHostnameKey: "a.example.com"}, want: true},
+		{annotations: map[string]string{annotationControllerKey: "dns-controller"}, want: true},
+		{annotations: map[string]string{annotationControllerKey: "other-controller"}},
+		{annotations: map[string]string{annotationControllerKey: ""}},
+	}
+	for _, test := range tests {
+		if got := isManaged(test.annotations); got != test.want {
+			t.Errorf("isManaged(%v) = %v, want %v", test.annotations, got, test.want)
+		}
+	}
+}
+
+func TestNodeTargets(t *testing.T) {
+	node := func(name string, addresses ...corev1.NodeAddress) *corev1.Node {
+		ret := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		ret.Status.Addresses = addresses
+		return ret
+	}
+	external := func(address string) corev1.NodeAddress {
+		return corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: address}
+	}
+	internal := func(address string) corev1.NodeAddress {
+		return corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: address}
+	}
+	hostname := corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node"}
+	tests := []struct {
+		name   string
+		nodes  []*corev1.Node
+		access string
+		want   []string
+	}{
+		{
+			name:  "external addresses",
+			nodes: []*corev1.Node{node("a", external("1.1.1.1"), internal("10.0.0.1"), hostname), node("b", external("1.1.1.2"), internal("10.0.0.2"))},
+			want:  []string{"1.1.1.1", "1.1.1.2"},
+		},
+		{
+			name:   "public access",
+			nodes:  []*corev1.Node{node("a", external("1.1.1.1"), internal("10.0.0.1")), node("b", internal("10.0.0.2"))},
+			access: "public",
+			want:   []string{"1.1.1.1"},
+		},
+		{
+			name:   "private access",
+			nodes:  []*corev1.Node{node("a", external("1.1.1.1"), internal("10.0.0.1")), node("b", internal("10.0.0.2"))},
+			access: "private",
+			want:   []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:  "no external addresses",
+			nodes: []*corev1.Node{node("a", internal("10.0.0.1"), hostname), node("b", internal("10.0.0.2"))},
+			want:  []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:   "public access without external addresses",
+			nodes:  []*corev1.Node{node("a", internal("10.0.0.1"))},
+			access: "public",
+		},
+		{
+			name:  "shared addresses",
+			nodes: []*corev1.Node{node("a", external("1.1.1.1")), node("b", external("1.1.1.1"))},
+			want:  []string{"1.1.1.1"},
+		},
+	}
+	for _, test := range tests {
+		client := fake.NewSimpleClientset()
+		for _, item := range test.nodes {
+			if _, err := client.CoreV1().Nodes().Create(context.Background(), item, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("Could not create node %s: %v", item.Name, err)
+			}
+		}
+		kube := &Kube{Client: client}
+		got, err := kube.nodeTargets(context.Background(), test.access)
+		if err != nil {
+			t.Fatalf("%s: nodeTargets returned %v", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: nodeTargets = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EndpointGroupVersion is the group version of the DNSEndpoint resources read
+// by the external-dns crd source
+const EndpointGroupVersion = "externaldns.k8s.io/v1alpha1"
+
+// Endpoint is a record declared by a DNSEndpoint
+type Endpoint struct {
+	DNSName    string
+	RecordType string
+	Targets    []string
+	TTL        int64 // TTL is zero when the DNSEndpoint leaves it to the provider
+}
+
+// dnsEndpoint holds the fields ednsctl needs from a DNSEndpoint
+type dnsEndpoint struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Endpoints []struct {
+			DNSName    string   `json:"dnsName"`
+			RecordTTL  int64    `json:"recordTTL"`
+			RecordType string   `json:"recordType"`
+			Targets    []string `json:"targets"`
+		} `json:"endpoints"`
+	} `json:"spec"`
+}
+
+// getEndpointHosts adds the hostnames declared by DNSEndpoints to hosts. Every
+// endpoint is a resource of its own carrying the declared record so it can be
+// compared with the zone.
+func (k *Kube) getEndpointHosts(ctx context.Context, hosts Hostnames) error {
+	if k.EndpointVersion == "" {
+		return nil
+	}
+	for _, ns := range k.Namespaces {
+		items, err := k.listDynamic(ctx, k.EndpointVersion, "dnsendpoints", ns)
+		if err != nil {
+			return err
+		}
+		for _, obj := range items {
+			var item dnsEndpoint
+			if err := fromUnstructured(obj, &item); err != nil {
+				return err
+			}
+			if !isManaged(item.Annotations) {
+				continue
+			}
+			for _, endpoint := range item.Spec.Endpoints {
+				resource := Resource{
+					Name:      item.Name,
+					Namespace: ns,
+					Kind:      "crd",
+					Endpoint: &Endpoint{
+						DNSName:    strings.TrimSuffix(endpoint.DNSName, "."),
+						RecordType: endpoint.RecordType,
+						Targets:    endpoint.Targets,
+						TTL:        endpoint.RecordTTL,
+					},
+				}
+				k.Resources[resource.String()] = resource
+				for _, target := range endpoint.Targets {
+					target = strings.TrimSuffix(target, ".")
+					k.ValidTargets[target] = appendMissing(k.ValidTargets[target], "crd/"+item.Name)
+				}
+				for _, host := range hostsInDomain([]string{resource.Endpoint.DNSName}, k.Domain, k.IgnoredSubDomains) {
+					hosts[host] = append(hosts[host], resource)
+				}
+			}
+		}
+	}
+	return nil
+}
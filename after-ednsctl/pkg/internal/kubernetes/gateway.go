@@ -0,0 +1,271 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GatewayGroup is the API group of the Gateway API
+const GatewayGroup = "gateway.networking.k8s.io"
+
+// gatewayGroupVersions are the Gateway API versions, newest first
+var gatewayGroupVersions = []string{GatewayGroup + "/v1", GatewayGroup + "/v1beta1", GatewayGroup + "/v1alpha2"}
+
+// routeKinds maps the kinds of the Gateway API routes external-dns has sources
+// for to their resource names
+var routeKinds = map[string]string{
+	"grpcroute": "grpcroutes",
+	"httproute": "httproutes",
+	"tcproute":  "tcproutes",
+	"tlsroute":  "tlsroutes",
+	"udproute":  "udproutes",
+}
+
+// gateway holds the fields ednsctl needs from a Gateway
+type gateway struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Listeners []struct {
+			Name     string  `json:"name"`
+			Hostname *string `json:"hostname"`
+		} `json:"listeners"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Value string `json:"value"`
+		} `json:"addresses"`
+	} `json:"status"`
+}
+
+// route holds the fields ednsctl needs from any kind of Gateway API route
+type route struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Hostnames  []string    `json:"hostnames"`
+		ParentRefs []parentRef `json:"parentRefs"`
+	} `json:"spec"`
+	Status struct {
+		Parents []struct {
+			ParentRef  parentRef          `json:"parentRef"`
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"parents"`
+	} `json:"status"`
+}
+
+type parentRef struct {
+	Group       *string `json:"group"`
+	Kind        *string `json:"kind"`
+	Namespace   *string `json:"namespace"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName"`
+}
+
+// discoverGatewayVersions returns the group version of every Gateway API
+// resource the server serves
+func (k *Kube) discoverGatewayVersions() (map[string]string, error) {
+	ret := make(map[string]string)
+	resources := []string{"gateways"}
+	for _, resource := range routeKinds {
+		resources = append(resources, resource)
+	}
+	for _, resource := range resources {
+		version, err := k.discoverVersion(resource, gatewayGroupVersions)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" {
+			ret[resource] = version
+		}
+	}
+	return ret, nil
+}
+
+// getGatewayHosts adds the hostnames of the routes attached to a Gateway to
+// hosts. The routes are the resources of the hostnames and their targets are
+// the addresses of the Gateways.
+func (k *Kube) getGatewayHosts(ctx context.Context, hosts Hostnames) error {
+	if _, exists := k.GatewayVersions["gateways"]; !exists {
+		return nil
+	}
+	gateways := make(map[string]gateway)
+	for _, ns := range k.Namespaces {
+		items, err := k.listDynamic(ctx, k.GatewayVersions["gateways"], "gateways", ns)
+		if err != nil {
+			return err
+		}
+		for _, obj := range items {
+			var item gateway
+			if err := fromUnstructured(obj, &item); err != nil {
+				return err
+			}
+			k.addValidTargets(item.targets(), "gateway/"+item.Name)
+			gateways[ns+"/"+item.Name] = item
+		}
+	}
+	for _, kind := range sortedRouteKinds() {
+		if _, exists := k.GatewayVersions[routeKinds[kind]]; !exists {
+			continue
+		}
+		for _, ns := range k.Namespaces {
+			items, err := k.listDynamic(ctx, k.GatewayVersions[routeKinds[kind]], routeKinds[kind], ns)
+			if err != nil {
+				return err
+			}
+			for _, obj := range items {
+				var item route
+				if err := fromUnstructured(obj, &item); err != nil {
+					return err
+				}
+				routeHosts, targets := item.attached(gateways)
+				if len(targets) == 0 {
+					continue
+				}
+				resource := withAnnotations(Resource{
+					Name:      item.Name,
+					Namespace: ns,
+					Kind:      kind,
+					Targets:   targets,
+				}, item.Annotations)
+				k.Resources[resource.String()] = resource
+				if !isManaged(item.Annotations) {
+					continue
+				}
+				k.addHosts(hosts, resource, append(routeHosts, splitAnnotation(item.Annotations, annotationHostnameKey)...))
+			}
+		}
+	}
+	return nil
+}
+
+// attached returns the hostnames the route is served under by the Gateways that
+// accepted it, along with the addresses of those Gateways
+func (r route) attached(gateways map[string]gateway) ([]string, []string) {
+	var hosts, targets []string
+	for _, ref := range r.Spec.ParentRefs {
+		if !ref.isGateway() || !r.accepted(ref) {
+			continue
+		}
+		gw, exists := gateways[ref.namespace(r.Namespace)+"/"+ref.Name]
+		if !exists {
+			continue
+		}
+		for _, target := range gw.targets() {
+			targets = appendMissing(targets, target)
+		}
+		for _, listener := range gw.Spec.Listeners {
+			if ref.SectionName != nil && *ref.SectionName != listener.Name {
+				continue
+			}
+			var listenerHost string
+			if listener.Hostname != nil {
+				listenerHost = *listener.Hostname
+			}
+			if len(r.Spec.Hostnames) == 0 && listenerHost != "" {
+				hosts = appendMissing(hosts, listenerHost)
+			}
+			for _, routeHost := range r.Spec.Hostnames {
+				if host, ok := intersectHostnames(routeHost, listenerHost); ok {
+					hosts = appendMissing(hosts, host)
+				}
+			}
+		}
+	}
+	return hosts, targets
+}
+
+// targets returns the addresses of the Gateway unless its target annotation
+// overrides them
+func (g gateway) targets() []string {
+	var addresses []string
+	for _, address := range g.Status.Addresses {
+		addresses = append(addresses, address.Value)
+	}
+	return targetsOrOverride(g.Annotations, addresses)
+}
+
+// accepted reports whether the status of the route has an Accepted condition
+// set by the parent
+func (r route) accepted(ref parentRef) bool {
+	for _, parent := range r.Status.Parents {
+		if parent.ParentRef.Name != ref.Name || parent.ParentRef.namespace(r.Namespace) != ref.namespace(r.Namespace) {
+			continue
+		}
+		if ref.SectionName != nil && (parent.ParentRef.SectionName == nil || *parent.ParentRef.SectionName != *ref.SectionName) {
+			continue
+		}
+		for _, condition := range parent.Conditions {
+			if condition.Type == "Accepted" && condition.Status == metav1.ConditionTrue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p parentRef) isGateway() bool {
+	return (p.Group == nil || *p.Group == GatewayGroup) && (p.Kind == nil || *p.Kind == "Gateway")
+}
+
+// namespace returns the namespace of the parent, which defaults to the namespace of the route
+func (p parentRef) namespace(routeNamespace string) string {
+	if p.Namespace == nil || *p.Namespace == "" {
+		return routeNamespace
+	}
+	return *p.Namespace
+}
+
+// intersectHostnames returns the most specific of a route and listener hostname
+// when one matches the other. An empty listener hostname matches everything and
+// a leading wildcard label matches one or more labels.
+func intersectHostnames(routeHost, listenerHost string) (string, bool) {
+	switch {
+	case listenerHost == "" || routeHost == listenerHost:
+		{
+			return routeHost, true
+		}
+	case strings.HasPrefix(listenerHost, "*.") && strings.HasSuffix(routeHost, listenerHost[1:]):
+		{
+			return routeHost, true
+		}
+	case strings.HasPrefix(routeHost, "*.") && strings.HasSuffix(listenerHost, routeHost[1:]):
+		{
+			return listenerHost, true
+		}
+	default:
+		{
+			return "", false
+		}
+	}
+}
+
+func sortedRouteKinds() []string {
+	var ret []string
+	for kind := range routeKinds {
+		ret = append(ret, kind)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func appendMissing(values []string, value string) []string {
+	for _, item := range values {
+		if item == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,238 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decode unmarshals the JSON document into obj
+func decode(t *testing.T, doc string, obj interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(doc), obj); err != nil {
+		t.Fatalf("Could not decode %s: %v", doc, err)
+	}
+}
+
+func TestIntersectHostnames(t *testing.T) {
+	tests := []struct {
+		route    string
+		listener string
+		want     string
+		ok       bool
+	}{
+		{route: "a.example.com", listener: "", want: "a.example.com", ok: true},
+		{route: "*.example.com", listener: "", want: "*.example.com", ok: true},
+		{route: "a.example.com", listener: "a.example.com", want: "a.example.com", ok: true},
+		{route: "a.example.com", listener: "b.example.com"},
+		{route: "a.example.com", listener: "*.example.com", want: "a.example.com", ok: true},
+		{route: "a.b.example.com", listener: "*.example.com", want: "a.b.example.com", ok: true},
+		{route: "example.com", listener: "*.example.com"},
+		{route: "a.example.org", listener: "*.example.com"},
+		{route: "*.example.com", listener: "a.example.com", want: "a.example.com", ok: true},
+		{route: "*.example.com", listener: "a.b.example.com", want: "a.b.example.com", ok: true},
+		{route: "*.example.com", listener: "*.example.com", want: "*.example.com", ok: true},
+		{route: "*.example.com", listener: "example.com"},
+	}
+	for _, test := range tests {
+		got, ok := intersectHostnames(test.route, test.listener)
+		if got != test.want || ok != test.ok {
+			t.Errorf("intersectHostnames(%q, %q) = %q, %v, want %q, %v", test.route, test.listener, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRouteAccepted(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		parents string
+		want    bool
+	}{
+		{
+			name:    "accepted",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+		{
+			name:    "not accepted",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw"}, "conditions": [{"type": "Accepted", "status": "False"}]}]`,
+		},
+		{
+			name:    "other condition",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw"}, "conditions": [{"type": "ResolvedRefs", "status": "True"}]}]`,
+		},
+		{
+			name:    "other parent",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "other"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+		},
+		{
+			name:    "namespace of the route in the status",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw", "namespace": "apps"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+		{
+			name:    "namespace of the route in the reference",
+			ref:     `{"name": "gw", "namespace": "apps"}`,
+			parents: `[{"parentRef": {"name": "gw"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+		{
+			name:    "other namespace",
+			ref:     `{"name": "gw", "namespace": "infra"}`,
+			parents: `[{"parentRef": {"name": "gw", "namespace": "infra"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+		{
+			name:    "other namespace only in the status",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw", "namespace": "infra"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+		},
+		{
+			name:    "same section",
+			ref:     `{"name": "gw", "sectionName": "https"}`,
+			parents: `[{"parentRef": {"name": "gw", "sectionName": "https"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+		{
+			name: "other section",
+			ref:  `{"name": "gw", "sectionName": "https"}`,
+			parents: `[{"parentRef": {"name": "gw", "sectionName": "http"}, "conditions": [{"type": "Accepted", "status": "True"}]},
+				{"parentRef": {"name": "gw"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+		},
+		{
+			name:    "any section",
+			ref:     `{"name": "gw"}`,
+			parents: `[{"parentRef": {"name": "gw", "sectionName": "http"}, "conditions": [{"type": "Accepted", "status": "True"}]}]`,
+			want:    true,
+		},
+	}
+	for _, test := range tests {
+		var item route
+		decode(t, `{"metadata": {"name": "web", "namespace": "apps"}, "status": {"parents": `+test.parents+`}}`, &item)
+		var ref parentRef
+		decode(t, test.ref, &ref)
+		if got := item.accepted(ref); got != test.want {
+			t.Errorf("%s: accepted = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRouteAttached(t *testing.T) {
+	var gw gateway
+	decode(t, `{
+		"metadata": {"name": "gw", "namespace": "infra"},
+		"spec": {"listeners": [
+			{"name": "http"},
+			{"name": "https", "hostname": "*.example.com"},
+			{"name": "api", "hostname": "api.example.com"}
+		]},
+		"status": {"addresses": [{"value": "lb.example.net"}, {"value": "10.0.0.1"}]}
+	}`, &gw)
+	gateways := map[string]gateway{"infra/gw": gw}
+	accepted := `{"type": "Accepted", "status": "True"}`
+	tests := []struct {
+		name      string
+		namespace string
+		hostnames string
+		ref       string
+		condition string
+		hosts     []string
+		targets   []string
+	}{
+		{
+			name:      "route hostname",
+			namespace: "apps",
+			hostnames: `["a.example.com", "a.example.org"]`,
+			ref:       `{"name": "gw", "namespace": "infra"}`,
+			condition: accepted,
+			hosts:     []string{"a.example.com", "a.example.org"},
+			targets:   []string{"lb.example.net", "10.0.0.1"},
+		},
+		{
+			name:      "listener hostnames",
+			namespace: "apps",
+			hostnames: `[]`,
+			ref:       `{"name": "gw", "namespace": "infra"}`,
+			condition: accepted,
+			hosts:     []string{"*.example.com", "api.example.com"},
+			targets:   []string{"lb.example.net", "10.0.0.1"},
+		},
+		{
+			name:      "wildcard section",
+			namespace: "apps",
+			hostnames: `["a.example.com", "a.example.org"]`,
+			ref:       `{"name": "gw", "namespace": "infra", "sectionName": "https"}`,
+			condition: accepted,
+			hosts:     []string{"a.example.com"},
+			targets:   []string{"lb.example.net", "10.0.0.1"},
+		},
+		{
+			name:      "wildcard route on a section",
+			namespace: "apps",
+			hostnames: `["*.example.com"]`,
+			ref:       `{"name": "gw", "namespace": "infra", "sectionName": "api"}`,
+			condition: accepted,
+			hosts:     []string{"api.example.com"},
+			targets:   []string{"lb.example.net", "10.0.0.1"},
+		},
+		{
+			name:      "gateway in the namespace of the route",
+			namespace: "infra",
+			hostnames: `["a.example.com"]`,
+			ref:       `{"name": "gw"}`,
+			condition: accepted,
+			hosts:     []string{"a.example.com"},
+			targets:   []string{"lb.example.net", "10.0.0.1"},
+		},
+		{
+			name:      "gateway in another namespace",
+			namespace: "apps",
+			hostnames: `["a.example.com"]`,
+			ref:       `{"name": "gw"}`,
+			condition: accepted,
+		},
+		{
+			name:      "not accepted",
+			namespace: "apps",
+			hostnames: `["a.example.com"]`,
+			ref:       `{"name": "gw", "namespace": "infra"}`,
+			condition: `{"type": "Accepted", "status": "False"}`,
+		},
+		{
+			name:      "not a gateway",
+			namespace: "apps",
+			hostnames: `["a.example.com"]`,
+			ref:       `{"name": "gw", "namespace": "infra", "kind": "Service", "group": ""}`,
+			condition: accepted,
+		},
+	}
+	for _, test := range tests {
+		var item route
+		decode(t, `{
+			"metadata": {"name": "web", "namespace": "`+test.namespace+`"},
+			"spec": {"hostnames": `+test.hostnames+`, "parentRefs": [`+test.ref+`]},
+			"status": {"parents": [{"parentRef": `+test.ref+`, "conditions": [`+test.condition+`]}]}
+		}`, &item)
+		hosts, targets := item.attached(gateways)
+		if !reflect.DeepEqual(hosts, test.hosts) || !reflect.DeepEqual(targets, test.targets) {
+			t.Errorf("%s: attached = %v, %v, want %v, %v", test.name, hosts, targets, test.hosts, test.targets)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	annotationIngressClassKey string = "kubernetes.io/ingress.class"
+)
+
+// The group versions ingresses are served from, newest first
+const (
+	NetworkingV1      = "networking.k8s.io/v1"
+	NetworkingV1beta1 = "networking.k8s.io/v1beta1"
+	ExtensionsV1beta1 = "extensions/v1beta1"
+)
+
+var ingressVersions = []string{NetworkingV1, NetworkingV1beta1, ExtensionsV1beta1}
+
+// ingress holds the fields ednsctl needs from any version of the Ingress API
+type ingress struct {
+	Annotations map[string]string
+	ClassName   string
+	Hosts       []string
+	Name        string
+	Targets     []string
+}
+
+// getIngresses lists the ingresses in the namespace through the discovered ingress API
+func (k *Kube) getIngresses(ctx context.Context, ns string) ([]ingress, error) {
+	var ret []ingress
+	switch k.IngressVersion {
+	case NetworkingV1:
+		{
+			list, err := k.Client.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Error getting ingresses in namespace %s: %v", ns, err)
+			}
+			for _, item := range list.Items {
+				var hosts []string
+				for _, rule := range item.Spec.Rules {
+					hosts = append(hosts, rule.Host)
+				}
+				ret = append(ret, newIngress(item.ObjectMeta, item.Spec.IngressClassName, hosts, item.Status.LoadBalancer))
+			}
+		}
+	case NetworkingV1beta1:
+		{
+			list, err := k.Client.NetworkingV1beta1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Error getting ingresses in namespace %s: %v", ns, err)
+			}
+			for _, item := range list.Items {
+				var hosts []string
+				for _, rule := range item.Spec.Rules {
+					hosts = append(hosts, rule.Host)
+				}
+				ret = append(ret, newIngress(item.ObjectMeta, item.Spec.IngressClassName, hosts, item.Status.LoadBalancer))
+			}
+		}
+	case ExtensionsV1beta1:
+		{
+			list, err := k.Client.ExtensionsV1beta1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Error getting ingresses in namespace %s: %v", ns, err)
+			}
+			for _, item := range list.Items {
+				var hosts []string
+				for _, rule := range item.Spec.Rules {
+					hosts = append(hosts, rule.Host)
+				}
+				ret = append(ret, newIngress(item.ObjectMeta, item.Spec.IngressClassName, hosts, item.Status.LoadBalancer))
+			}
+		}
+	}
+	return ret, nil
+}
+
+// newIngress takes the class from spec.ingressClassName, falling back to the
+// deprecated kubernetes.io/ingress.class annotation
+func newIngress(meta metav1.ObjectMeta, className *string, hosts []string, status corev1.LoadBalancerStatus) ingress {
+	ret := ingress{
+		Annotations: meta.Annotations,
+		ClassName:   meta.Annotations[annotationIngressClassKey],
+		Hosts:       hosts,
+		Name:        meta.Name,
+		Targets:     statusTargets(status),
+	}
+	if className != nil && *className != "" {
+		ret.ClassName = *className
+	}
+	return ret
+}
+
+// hasClass reports whether the ingress belongs to one of the given classes.
+// Every ingress matches when no class is given.
+func (i ingress) hasClass(classes []string) bool {
+	if len(classes) == 0 {
+		return true
+	}
+	for _, class := range classes {
+		if class == i.ClassName {
+			return true
+		}
+	}
+	return false
+}
+
+// statusTargets returns the hostname, or else the IP, of every load balancer
+// of a service or ingress
+func statusTargets(status corev1.LoadBalancerStatus) []string {
+	var ret []string
+	for _, item := range status.Ingress {
+		if item.Hostname != "" {
+			ret = appendMissing(ret, item.Hostname)
+		} else if item.IP != "" {
+			ret = appendMissing(ret, item.IP)
+		}
+	}
+	return ret
+}
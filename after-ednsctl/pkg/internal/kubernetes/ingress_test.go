@@ -0,0 +1,237 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newFakeKube returns a Kube for the example.com domain talking to a fake
+// client that serves ingresses from the given group versions and holds the
+// default namespace and the objects
+func newFakeKube(t *testing.T, ingressVersions []string, objects ...runtime.Object) *Kube {
+	t.Helper()
+	objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	client := fake.NewSimpleClientset(objects...)
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	for _, version := range ingressVersions {
+		discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+			GroupVersion: version,
+			APIResources: []metav1.APIResource{{Name: "ingresses", Kind: "Ingress", Namespaced: true}},
+		})
+	}
+	kube, err := NewWithClient(context.Background(), client, "example.com", nil)
+	if err != nil {
+		t.Fatalf("NewWithClient returned %v", err)
+	}
+	return kube
+}
+
+func TestDiscoverIngressVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		want     string
+	}{
+		{name: "every version", versions: []string{ExtensionsV1beta1, NetworkingV1beta1, NetworkingV1}, want: NetworkingV1},
+		{name: "no networking/v1", versions: []string{ExtensionsV1beta1, NetworkingV1beta1}, want: NetworkingV1beta1},
+		{name: "only extensions", versions: []string{ExtensionsV1beta1}, want: ExtensionsV1beta1},
+		{name: "no ingress API"},
+	}
+	for _, test := range tests {
+		if got := newFakeKube(t, test.versions).IngressVersion; got != test.want {
+			t.Errorf("%s: IngressVersion = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// a group version serving other resources is not used for ingresses
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{GroupVersion: NetworkingV1, APIResources: []metav1.APIResource{{Name: "networkpolicies"}}},
+		{GroupVersion: ExtensionsV1beta1, APIResources: []metav1.APIResource{{Name: "ingresses"}}},
+	}
+	kube, err := NewWithClient(context.Background(), client, "example.com", nil)
+	if err != nil {
+		t.Fatalf("NewWithClient returned %v", err)
+	}
+	if kube.IngressVersion != ExtensionsV1beta1 {
+		t.Errorf("IngressVersion = %q, want %q", kube.IngressVersion, ExtensionsV1beta1)
+	}
+}
+
+// ingressMeta returns the metadata of an ingress in the default namespace with
+// the class annotation when it is not empty
+func ingressMeta(name, annotationClass string) metav1.ObjectMeta {
+	ret := metav1.ObjectMeta{Name: name, Namespace: "default"}
+	if annotationClass != "" {
+		ret.Annotations = map[string]string{annotationIngressClassKey: annotationClass}
+	}
+	return ret
+}
+
+func loadBalancer(hostname string) corev1.LoadBalancerStatus {
+	return corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{Hostname: hostname}}}
+}
+
+func TestGetIngresses(t *testing.T) {
+	external := "external"
+	tests := []struct {
+		version string
+		objects []runtime.Object
+	}{
+		{
+			version: NetworkingV1,
+			objects: []runtime.Object{
+				&networkingv1.Ingress{
+					ObjectMeta: ingressMeta("both", "nginx"),
+					Spec: networkingv1.IngressSpec{
+						IngressClassName: &external,
+						Rules:            []networkingv1.IngressRule{{Host: "both.example.com"}},
+					},
+					Status: networkingv1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+				&networkingv1.Ingress{
+					ObjectMeta: ingressMeta("annotation", "nginx"),
+					Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "annotation.example.com"}}},
+					Status:     networkingv1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+			},
+		},
+		{
+			version: NetworkingV1beta1,
+			objects: []runtime.Object{
+				&networkingv1beta1.Ingress{
+					ObjectMeta: ingressMeta("both", "nginx"),
+					Spec: networkingv1beta1.IngressSpec{
+						IngressClassName: &external,
+						Rules:            []networkingv1beta1.IngressRule{{Host: "both.example.com"}},
+					},
+					Status: networkingv1beta1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+				&networkingv1beta1.Ingress{
+					ObjectMeta: ingressMeta("annotation", "nginx"),
+					Spec:       networkingv1beta1.IngressSpec{Rules: []networkingv1beta1.IngressRule{{Host: "annotation.example.com"}}},
+					Status:     networkingv1beta1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+			},
+		},
+		{
+			version: ExtensionsV1beta1,
+			objects: []runtime.Object{
+				&extensionsv1beta1.Ingress{
+					ObjectMeta: ingressMeta("both", "nginx"),
+					Spec: extensionsv1beta1.IngressSpec{
+						IngressClassName: &external,
+						Rules:            []extensionsv1beta1.IngressRule{{Host: "both.example.com"}},
+					},
+					Status: extensionsv1beta1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+				&extensionsv1beta1.Ingress{
+					ObjectMeta: ingressMeta("annotation", "nginx"),
+					Spec:       extensionsv1beta1.IngressSpec{Rules: []extensionsv1beta1.IngressRule{{Host: "annotation.example.com"}}},
+					Status:     extensionsv1beta1.IngressStatus{LoadBalancer: loadBalancer("lb.example.net")},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		kube := newFakeKube(t, []string{test.version}, test.objects...)
+		ingresses, err := kube.getIngresses(context.Background(), "default")
+		if err != nil {
+			t.Fatalf("%s: getIngresses returned %v", test.version, err)
+		}
+		classes := make(map[string]string)
+		for _, item := range ingresses {
+			classes[item.Name] = item.ClassName
+			if want := []string{item.Name + ".example.com"}; !reflect.DeepEqual(item.Hosts, want) {
+				t.Errorf("%s: the hosts of %s are %v, want %v", test.version, item.Name, item.Hosts, want)
+			}
+			if want := []string{"lb.example.net"}; !reflect.DeepEqual(item.Targets, want) {
+				t.Errorf("%s: the targets of %s are %v, want %v", test.version, item.Name, item.Targets, want)
+			}
+		}
+		// spec.ingressClassName takes precedence over the annotation
+		if want := map[string]string{"both": "external", "annotation": "nginx"}; !reflect.DeepEqual(classes, want) {
+			t.Errorf("%s: the ingress classes are %v, want %v", test.version, classes, want)
+		}
+
+		// ingresses of other versions are not listed
+		kube.IngressVersion = ""
+		if ingresses, _ = kube.getIngresses(context.Background(), "default"); len(ingresses) != 0 {
+			t.Errorf("%s: getIngresses without an ingress API returned %v", test.version, ingresses)
+		}
+	}
+}
+
+func TestHasClass(t *testing.T) {
+	tests := []struct {
+		class   string
+		classes []string
+		want    bool
+	}{
+		{class: "nginx", want: true},
+		{class: "", want: true},
+		{class: "nginx", classes: []string{"external", "nginx"}, want: true},
+		{class: "internal", classes: []string{"external", "nginx"}, want: false},
+		{class: "", classes: []string{"external"}, want: false},
+	}
+	for _, test := range tests {
+		if got := (ingress{ClassName: test.class}).hasClass(test.classes); got != test.want {
+			t.Errorf("hasClass(%v) of class %q = %v, want %v", test.classes, test.class, got, test.want)
+		}
+	}
+}
+
+func TestGetHostsFiltersIngressClasses(t *testing.T) {
+	external := "external"
+	kube := newFakeKube(t, []string{NetworkingV1},
+		&networkingv1.Ingress{
+			ObjectMeta: ingressMeta("public", "nginx"),
+			Spec: networkingv1.IngressSpec{
+				IngressClassName: &external,
+				Rules:            []networkingv1.IngressRule{{Host: "public.example.com"}},
+			},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: ingressMeta("private", "nginx"),
+			Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "private.example.com"}}},
+		},
+	)
+	kube.IngressClasses = []string{"external"}
+	hosts, err := kube.GetHosts(context.Background())
+	if err != nil {
+		t.Fatalf("GetHosts returned %v", err)
+	}
+	if got := hosts.Sorted(); !reflect.DeepEqual(got, []Hostname{"public.example.com"}) {
+		t.Errorf("GetHosts returned %v, want only public.example.com", got)
+	}
+	var resources []string
+	for key := range kube.Resources {
+		resources = append(resources, key)
+	}
+	sort.Strings(resources)
+	if want := []string{"ingress/default/public"}; !reflect.DeepEqual(resources, want) {
+		t.Errorf("the resources seen are %v, want %v", resources, want)
+	}
+}
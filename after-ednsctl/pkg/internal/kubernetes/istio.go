@@ -0,0 +1,214 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// IstioGroup is the API group of the Istio networking resources
+const IstioGroup = "networking.istio.io"
+
+// istioGroupVersions are the Istio networking versions, newest first
+var istioGroupVersions = []string{IstioGroup + "/v1", IstioGroup + "/v1beta1", IstioGroup + "/v1alpha3"}
+
+// istioGateway holds the fields ednsctl needs from an Istio Gateway
+type istioGateway struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Selector map[string]string `json:"selector"`
+		Servers  []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"servers"`
+	} `json:"spec"`
+}
+
+// virtualService holds the fields ednsctl needs from an Istio VirtualService
+type virtualService struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Gateways []string `json:"gateways"`
+		Hosts    []string `json:"hosts"`
+	} `json:"spec"`
+}
+
+// discoverIstioVersions returns the group version of every Istio resource
+// external-dns has a source for that the server serves
+func (k *Kube) discoverIstioVersions() (map[string]string, error) {
+	ret := make(map[string]string)
+	for _, resource := range []string{"gateways", "virtualservices"} {
+		version, err := k.discoverVersion(resource, istioGroupVersions)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" {
+			ret[resource] = version
+		}
+	}
+	return ret, nil
+}
+
+// getIstioHosts adds the hostnames of Istio Gateways and of the VirtualServices
+// bound to them to hosts. Their targets are the load balancers of the services
+// selected by the Gateways, as external-dns does.
+func (k *Kube) getIstioHosts(ctx context.Context, hosts Hostnames, services []corev1.Service) error {
+	if _, exists := k.IstioVersions["gateways"]; !exists {
+		return nil
+	}
+	gateways := make(map[string]istioGateway)
+	targets := make(map[string][]string)
+	for _, ns := range k.Namespaces {
+		items, err := k.listDynamic(ctx, k.IstioVersions["gateways"], "gateways", ns)
+		if err != nil {
+			return err
+		}
+		for _, obj := range items {
+			var item istioGateway
+			if err := fromUnstructured(obj, &item); err != nil {
+				return err
+			}
+			key := ns + "/" + item.Name
+			gateways[key] = item
+			targets[key] = targetsOrOverride(item.Annotations, selectedTargets(item.Spec.Selector, services))
+			k.addValidTargets(targets[key], "gateway/"+item.Name)
+			var gatewayHosts []string
+			for _, server := range item.Spec.Servers {
+				for _, host := range server.Hosts {
+					if _, host := splitIstioHost(host); host != "*" {
+						gatewayHosts = append(gatewayHosts, host)
+					}
+				}
+			}
+			k.addIstioResource(hosts, "gateway", &item.ObjectMeta, gatewayHosts, targets[key])
+		}
+	}
+	if _, exists := k.IstioVersions["virtualservices"]; !exists {
+		return nil
+	}
+	for _, ns := range k.Namespaces {
+		items, err := k.listDynamic(ctx, k.IstioVersions["virtualservices"], "virtualservices", ns)
+		if err != nil {
+			return err
+		}
+		for _, obj := range items {
+			var item virtualService
+			if err := fromUnstructured(obj, &item); err != nil {
+				return err
+			}
+			var serviceHosts, serviceTargets []string
+			for _, name := range item.Spec.Gateways {
+				key := istioGatewayKey(name, ns)
+				gw, exists := gateways[key]
+				if !exists {
+					continue
+				}
+				for _, host := range item.Spec.Hosts {
+					if host != "*" && gw.binds(host, ns) {
+						serviceHosts = appendMissing(serviceHosts, host)
+					}
+				}
+				for _, target := range targets[key] {
+					serviceTargets = appendMissing(serviceTargets, target)
+				}
+			}
+			k.addIstioResource(hosts, "virtualservice", &item.ObjectMeta, serviceHosts, targetsOrOverride(item.Annotations, serviceTargets))
+		}
+	}
+	return nil
+}
+
+// addIstioResource records the resource and adds its hostnames in the domain,
+// along with those of its hostname annotation, to hosts
+func (k *Kube) addIstioResource(hosts Hostnames, kind string, meta *metav1.ObjectMeta, resourceHosts, targets []string) {
+	if len(targets) == 0 {
+		return
+	}
+	resource := withAnnotations(Resource{
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+		Kind:      kind,
+		Targets:   targets,
+	}, meta.Annotations)
+	k.Resources[resource.String()] = resource
+	if !isManaged(meta.Annotations) {
+		return
+	}
+	k.addHosts(hosts, resource, append(resourceHosts, splitAnnotation(meta.Annotations, annotationHostnameKey)...))
+}
+
+// binds reports whether a server of the Gateway accepts the host of a
+// VirtualService in the namespace
+func (g istioGateway) binds(host, namespace string) bool {
+	for _, server := range g.Spec.Servers {
+		for _, item := range server.Hosts {
+			ns, serverHost := splitIstioHost(item)
+			if ns != "*" && !(ns == "." && namespace == g.Namespace) && ns != namespace {
+				continue
+			}
+			if serverHost == "*" || serverHost == host {
+				return true
+			}
+			if strings.HasPrefix(serverHost, "*.") && strings.HasSuffix(host, serverHost[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectedTargets returns the load balancer addresses of the services whose
+// pods the Gateway selector picks
+func selectedTargets(selector map[string]string, services []corev1.Service) []string {
+	var ret []string
+	if len(selector) == 0 {
+		return ret
+	}
+	for _, service := range services {
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if !labels.SelectorFromSet(selector).Matches(labels.Set(service.Spec.Selector)) {
+			continue
+		}
+		for _, item := range service.Status.LoadBalancer.Ingress {
+			if item.Hostname != "" {
+				ret = appendMissing(ret, item.Hostname)
+			} else if item.IP != "" {
+				ret = appendMissing(ret, item.IP)
+			}
+		}
+	}
+	return ret
+}
+
+// splitIstioHost splits a namespace/host server host. Hosts without a
+// namespace are visible to every namespace.
+func splitIstioHost(host string) (string, string) {
+	if i := strings.Index(host, "/"); i >= 0 {
+		return host[:i], host[i+1:]
+	}
+	return "*", host
+}
+
+// istioGatewayKey returns the namespace/name key of a Gateway referenced by a
+// VirtualService, which defaults to the namespace of the VirtualService
+func istioGatewayKey(name, namespace string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return namespace + "/" + name
+}
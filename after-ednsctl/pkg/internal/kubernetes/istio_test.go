@@ -0,0 +1,105 @@
+// Copyright © 2019Luke Reed
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIstioGatewayBinds(t *testing.T) {
+	tests := []struct {
+		server    string
+		host      string
+		namespace string
+		want      bool
+	}{
+		{server: "a.example.com", host: "a.example.com", namespace: "apps", want: true},
+		{server: "b.example.com", host: "a.example.com", namespace: "apps"},
+		{server: "*", host: "a.example.org", namespace: "apps", want: true},
+		{server: "*.example.com", host: "a.example.com", namespace: "apps", want: true},
+		{server: "*.example.com", host: "a.b.example.com", namespace: "apps", want: true},
+		{server: "*.example.com", host: "example.com", namespace: "apps"},
+		{server: "*.example.com", host: "a.example.org", namespace: "apps"},
+		{server: "./a.example.com", host: "a.example.com", namespace: "istio-system", want: true},
+		{server: "./a.example.com", host: "a.example.com", namespace: "apps"},
+		{server: "*/a.example.com", host: "a.example.com", namespace: "apps", want: true},
+		{server: "apps/a.example.com", host: "a.example.com", namespace: "apps", want: true},
+		{server: "apps/a.example.com", host: "a.example.com", namespace: "web"},
+		{server: "apps/*", host: "a.example.org", namespace: "apps", want: true},
+		{server: "apps/*.example.com", host: "a.example.com", namespace: "web"},
+	}
+	for _, test := range tests {
+		var gw istioGateway
+		decode(t, `{"metadata": {"name": "gw", "namespace": "istio-system"}, "spec": {"servers": [{"hosts": ["other.example.net", "`+test.server+`"]}]}}`, &gw)
+		if got := gw.binds(test.host, test.namespace); got != test.want {
+			t.Errorf("server host %s binds %s in %s = %v, want %v", test.server, test.host, test.namespace, got, test.want)
+		}
+	}
+}
+
+func TestSelectedTargets(t *testing.T) {
+	service := func(name string, serviceType corev1.ServiceType, selector map[string]string, ingress ...corev1.LoadBalancerIngress) corev1.Service {
+		ret := corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "istio-system"}}
+		ret.Spec.Type = serviceType
+		ret.Spec.Selector = selector
+		ret.Status.LoadBalancer.Ingress = ingress
+		return ret
+	}
+	services := []corev1.Service{
+		service("ingressgateway", corev1.ServiceTypeLoadBalancer, map[string]string{"istio": "ingressgateway", "app": "istio"},
+			corev1.LoadBalancerIngress{Hostname: "lb.example.net", IP: "10.0.0.1"}),
+		service("ingressgateway-v2", corev1.ServiceTypeLoadBalancer, map[string]string{"istio": "ingressgateway"},
+			corev1.LoadBalancerIngress{Hostname: "lb.example.net"}, corev1.LoadBalancerIngress{IP: "10.0.0.2"}),
+		service("internal", corev1.ServiceTypeLoadBalancer, map[string]string{"istio": "internal"},
+			corev1.LoadBalancerIngress{IP: "10.1.0.1"}),
+		service("nodeport", corev1.ServiceTypeNodePort, map[string]string{"istio": "ingressgateway"},
+			corev1.LoadBalancerIngress{IP: "10.2.0.1"}),
+		service("no-selector", corev1.ServiceTypeLoadBalancer, nil,
+			corev1.LoadBalancerIngress{IP: "10.3.0.1"}),
+	}
+	tests := []struct {
+		selector map[string]string
+		want     []string
+	}{
+		{selector: map[string]string{"istio": "ingressgateway"}, want: []string{"lb.example.net", "10.0.0.2"}},
+		{selector: map[string]string{"istio": "ingressgateway", "app": "istio"}, want: []string{"lb.example.net"}},
+		{selector: map[string]string{"istio": "internal"}, want: []string{"10.1.0.1"}},
+		{selector: map[string]string{"istio": "egressgateway"}},
+		{selector: nil},
+	}
+	for _, test := range tests {
+		if got := selectedTargets(test.selector, services); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("selectedTargets(%v) = %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
+
+func TestIstioGatewayKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		want      string
+	}{
+		{name: "gw", namespace: "apps", want: "apps/gw"},
+		{name: "istio-system/gw", namespace: "apps", want: "istio-system/gw"},
+		{name: "apps/gw", namespace: "apps", want: "apps/gw"},
+	}
+	for _, test := range tests {
+		if got := istioGatewayKey(test.name, test.namespace); got != test.want {
+			t.Errorf("istioGatewayKey(%q, %q) = %q, want %q", test.name, test.namespace, got, test.want)
+		}
+	}
+}
@@ -8,3 +8,338 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	// Importing gcp auth client so we can get to GKE clusters
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+)
+
+const (
+	annotationHostnameKey string = "external-dns.alpha.kubernetes.io/hostname"
+)
+
+// Kinds are the kinds of the resources looked at by GetHosts
+var Kinds = []string{"ingress", "service", "httproute", "grpcroute", "tlsroute", "tcproute", "udproute", "gateway", "virtualservice", "crd"}
+
+// Kube is a wrapper around the kubernetes interface and holds all our relevant info
+type Kube struct {
+	Client            clientset.Interface
+	Dynamic           dynamic.Interface // Dynamic lists the Gateway API, Istio and DNSEndpoint resources, which are skipped when it is nil
+	Namespaces        []string
+	Domain            string // Domain is the DNS domain we want to match against for hostname checking
+	IgnoredSubDomains []string
+	IngressClasses    []string          // IngressClasses limits the ingresses looked at to these classes, all ingresses are looked at when empty
+	IngressVersion    string            // IngressVersion is the group version ingresses are listed from, empty when the server has no ingress API
+	GatewayVersions   map[string]string // GatewayVersions holds the group version each served Gateway API resource is listed from
+	IstioVersions     map[string]string // IstioVersions holds the group version each served Istio resource is listed from
+	EndpointVersion   string            // EndpointVersion is the group version DNSEndpoints are listed from, empty when the CRD is not installed
+	ValidTargets      map[string][]string
+	Resources         map[string]Resource // Resources holds every resource seen by GetHosts indexed by kind/namespace/name
+	nodes             []corev1.Node
+}
+
+// Hostname represents a public facing hostname along with the resource within the cluster that it points to
+type Hostname string
+
+// Resource maps to a single kube resource e.g. ingress
+type Resource struct {
+	Name          string
+	Namespace     string
+	Kind          string
+	Targets       []string  // Targets are the load balancer hostnames and IPs the resource is reached through
+	Endpoint      *Endpoint // Endpoint is the record declared by a DNSEndpoint, nil for every other kind
+	Alias         bool      // Alias is set by the alias annotation
+	SetIdentifier string    // SetIdentifier is set by the set-identifier annotation
+	TTL           int64     // TTL is set by the ttl annotation, zero otherwise
+}
+
+// String returns the resource in the kind/namespace/name form used by the TXT registry
+func (r Resource) String() string {
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// Hostnames map a Hostname to a Resource
+type Hostnames map[Hostname][]Resource
+
+// Sorted returns the hostnames in alphabetical order
+func (h Hostnames) Sorted() []Hostname {
+	var ret []Hostname
+	for host := range h {
+		ret = append(ret, host)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
+// New provides the kube client and a few other pieces of information needed when interacting with the cluster
+func New(ctx context.Context, domain string, ignoredSubdomains []string) (*Kube, error) {
+	client, dynamicClient, err := getKubeClients()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithClients(ctx, client, dynamicClient, domain, ignoredSubdomains)
+}
+
+// NewWithClient is the same as New but uses the given kubernetes client and
+// does not look at Gateway API, Istio and DNSEndpoint resources
+func NewWithClient(ctx context.Context, client clientset.Interface, domain string, ignoredSubdomains []string) (*Kube, error) {
+	return NewWithClients(ctx, client, nil, domain, ignoredSubdomains)
+}
+
+// NewWithClients is the same as New but uses the given kubernetes and dynamic clients
+func NewWithClients(ctx context.Context, client clientset.Interface, dynamicClient dynamic.Interface, domain string, ignoredSubdomains []string) (*Kube, error) {
+	var ret = Kube{
+		Client:            client,
+		Dynamic:           dynamicClient,
+		Domain:            domain,
+		IgnoredSubDomains: ignoredSubdomains,
+		ValidTargets:      make(map[string][]string),
+		Resources:         make(map[string]Resource),
+	}
+	namespaces, err := ret.getNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret.Namespaces = namespaces
+	ret.IngressVersion, err = ret.discoverVersion("ingresses", ingressVersions)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Dynamic != nil {
+		ret.GatewayVersions, err = ret.discoverGatewayVersions()
+		if err != nil {
+			return nil, err
+		}
+		ret.IstioVersions, err = ret.discoverIstioVersions()
+		if err != nil {
+			return nil, err
+		}
+		ret.EndpointVersion, err = ret.discoverVersion("dnsendpoints", []string{EndpointGroupVersion})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
+
+func getKubeClients() (clientset.Interface, dynamic.Interface, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	kubeConf, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting kubeconfig: %v", err)
+	}
+	client, err := clientset.NewForConfig(kubeConf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating kubernetes client: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating kubernetes dynamic client: %v", err)
+	}
+	return client, dynamicClient, nil
+}
+
+// discoverVersion returns the first of the group versions the server serves the
+// resource from, or an empty string if it serves none of them
+func (k *Kube) discoverVersion(resource string, groupVersions []string) (string, error) {
+	groups, err := k.Client.Discovery().ServerGroups()
+	if err != nil {
+		return "", fmt.Errorf("Error discovering the %s API: %v", resource, err)
+	}
+	served := make(map[string]bool)
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			served[version.GroupVersion] = true
+		}
+	}
+	for _, version := range groupVersions {
+		if !served[version] {
+			continue
+		}
+		resources, err := k.Client.Discovery().ServerResourcesForGroupVersion(version)
+		if err != nil {
+			return "", fmt.Errorf("Error discovering the %s API: %v", resource, err)
+		}
+		for _, item := range resources.APIResources {
+			if item.Name == resource {
+				return version, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// listDynamic lists the resource served from the group version in the namespace
+// through the dynamic client
+func (k *Kube) listDynamic(ctx context.Context, groupVersion, resource, ns string) ([]unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+	list, err := k.Dynamic.Resource(gv.WithResource(resource)).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting %s in namespace %s: %v", resource, ns, err)
+	}
+	return list.Items, nil
+}
+
+// fromUnstructured decodes a resource returned by the dynamic client into obj
+func fromUnstructured(item unstructured.Unstructured, obj interface{}) error {
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, obj)
+	if err != nil {
+		return fmt.Errorf("Error decoding %s %s/%s: %v", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+	}
+	return nil
+}
+
+func (k *Kube) getNamespaces(ctx context.Context) ([]string, error) {
+	var ret []string
+	namespaces, err := k.Client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting namespaces: %v", err)
+	}
+	for _, ns := range namespaces.Items {
+		ret = append(ret, ns.Name)
+	}
+	return ret, nil
+}
+
+// GetHosts returns a map of hostnames that are present in ingresses, services, Gateway API routes, Istio resources and DNSEndpoints indexing them to resources
+func (k *Kube) GetHosts(ctx context.Context) (Hostnames, error) {
+	var hosts = make(Hostnames)
+	var services []corev1.Service
+	for _, ns := range k.Namespaces {
+		ingresses, err := k.getIngresses(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		s, err := k.Client.CoreV1().Services(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Error getting services in namespace %s: %v", ns, err)
+		}
+		services = append(services, s.Items...)
+		for _, service := range s.Items {
+			targets, err := k.serviceTargets(ctx, service)
+			if err != nil {
+				return nil, err
+			}
+			targets = targetsOrOverride(service.Annotations, targets)
+			k.addValidTargets(targets, "service/"+service.Name)
+			resource := withAnnotations(Resource{
+				Name:      service.Name,
+				Namespace: ns,
+				Kind:      "service",
+				Targets:   targets,
+			}, service.Annotations)
+			k.Resources[resource.String()] = resource
+			if !isManaged(service.Annotations) {
+				continue
+			}
+			k.addHosts(hosts, resource, splitAnnotation(service.Annotations, annotationHostnameKey))
+			// internal hostnames point to the cluster IP whatever the type of the service
+			internalHosts := splitAnnotation(service.Annotations, annotationInternalHostnameKey)
+			if clusterIP := service.Spec.ClusterIP; len(internalHosts) > 0 && clusterIP != "" && clusterIP != corev1.ClusterIPNone {
+				k.addValidTargets([]string{clusterIP}, "service/"+service.Name)
+				internal := resource
+				internal.Targets = []string{clusterIP}
+				k.addHosts(hosts, internal, internalHosts)
+			}
+		}
+		for _, ingress := range ingresses {
+			if !ingress.hasClass(k.IngressClasses) {
+				continue
+			}
+			targets := targetsOrOverride(ingress.Annotations, ingress.Targets)
+			k.addValidTargets(targets, "ingress/"+ingress.Name)
+			resource := withAnnotations(Resource{
+				Name:      ingress.Name,
+				Namespace: ns,
+				Kind:      "ingress",
+				Targets:   targets,
+			}, ingress.Annotations)
+			k.Resources[resource.String()] = resource
+			if !isManaged(ingress.Annotations) {
+				continue
+			}
+			k.addHosts(hosts, resource, ingressHostnames(ingress))
+		}
+	}
+	err := k.getGatewayHosts(ctx, hosts)
+	if err != nil {
+		return nil, err
+	}
+	err = k.getIstioHosts(ctx, hosts, services)
+	if err != nil {
+		return nil, err
+	}
+	err = k.getEndpointHosts(ctx, hosts)
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// hostsInDomain returns the hostnames that are in the domain and not in an ignored subdomain
+func hostsInDomain(ruleHosts []string, domain string, ignoredSubdomains []string) []Hostname {
+	var hosts []Hostname
+	re, _ := regexp.Compile(`.*` + domain + `\.??`)
+Rules:
+	for _, host := range ruleHosts {
+		if host == "" {
+			continue
+		}
+		if !re.Match([]byte(host)) {
+			continue
+		}
+		for _, sub := range ignoredSubdomains {
+			if isIgnored(host, sub) {
+				continue Rules
+			}
+		}
+		hosts = append(hosts, Hostname(host))
+	}
+	return hosts
+}
+
+// IsIgnored reports whether the hostname is in one of the ignored subdomains
+func (k *Kube) IsIgnored(host string) bool {
+	for _, sub := range k.IgnoredSubDomains {
+		if isIgnored(host, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasKind reports whether resources of the kind are looked at by GetHosts
+func HasKind(kind string) bool {
+	for _, item := range Kinds {
+		if item == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func isIgnored(host string, ignoredSubdomain string) bool {
+	sub, _ := regexp.Compile(`.*` + ignoredSubdomain + `\.??`)
+	return sub.Match([]byte(host))
+}